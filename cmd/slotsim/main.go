@@ -0,0 +1,75 @@
+// slotsim spins a slot machine over and over without drawing
+// anything and reports what it pays back, for tuning the reels and
+// paytables in boards/slots.
+//
+//	go run ./cmd/slotsim -machine classic -spins 10000000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/games/slots/machine"
+)
+
+func main() {
+	name := flag.String("machine", "classic", "machine in "+machine.MachinesDir+", or a path to one")
+	spins := flag.Int("spins", 1_000_000, "how many spins to simulate")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "rng seed, the same seed and workers give the same results")
+	workers := flag.Int("workers", runtime.NumCPU(), "spins are split between this many goroutines")
+	flag.Parse()
+
+	m, err := machine.Load(*name)
+	if err != nil {
+		if m, err = machine.LoadFile(*name); err != nil {
+			log.Fatal(err)
+		}
+	}
+	start := time.Now()
+	r := machine.Simulate(m, *spins, *seed, *workers)
+
+	fmt.Printf("machine:       %s\n", m.Name)
+	for i, strip := range m.Strips {
+		fmt.Printf("reel %d:        %d stops\n", i+1, len(strip))
+	}
+	fmt.Printf("layout:        %dx%d, %d lines\n", m.Reels(), m.Rows, len(m.Lines))
+	fmt.Printf("spins:         %d in %s (seed %d, %d workers)\n", r.Spins, time.Since(start).Round(time.Millisecond), *seed, *workers)
+	fmt.Printf("rtp:           %.4f%%\n", r.RTP()*100)
+	fmt.Printf("hit frequency: %.4f%% (1 in %.2f)\n", r.HitFrequency()*100, 1/r.HitFrequency())
+	fmt.Printf("std dev:       %.3f\n", r.StdDev())
+	fmt.Printf("max pay:       %.2fx\n", r.MaxPay)
+	if r.Bonuses > 0 {
+		fmt.Printf("bonuses:       1 in %.1f, %.1f free spins each\n", float64(r.Spins)/float64(r.Bonuses), float64(r.FreeSpins)/float64(r.Bonuses))
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// rtp here is just what the pay itself returns, leaving out
+	// that some of the hits came from free spins
+	fmt.Fprintln(w, "pay\tmult\thits\t1 in\trtp")
+	lines := float64(len(m.Lines))
+	for i, p := range m.Pays {
+		row(w, m.PayName(i), fmt.Sprintf("%gx", p.Multiplier), p.Multiplier/lines, r.PayHits[i], r.Spins)
+	}
+	for _, n := range m.ScatterCounts() {
+		mult := fmt.Sprintf("%gx", m.ScatterMultiplier(n))
+		if spins := m.FreeSpinsFor(n); spins > 0 {
+			mult += fmt.Sprintf(" +%d free", spins)
+		}
+		row(w, fmt.Sprintf("%d scatter", n), mult, m.ScatterMultiplier(n), r.Scatter[n], r.Spins)
+	}
+	w.Flush()
+}
+
+func row(w *tabwriter.Writer, name, mult string, ret float64, hits, spins int) {
+	odds := "-"
+	if hits > 0 {
+		odds = fmt.Sprintf("%.1f", float64(spins)/float64(hits))
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%.3f%%\n", name, mult, hits, odds, float64(hits)*ret/float64(spins)*100)
+}
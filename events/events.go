@@ -0,0 +1,163 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	pendingBuffer = 256
+	backlogWarn   = 256 // events behind before the bot gets nagged about
+)
+
+var ledgerPath = "./results_ledger.jsonl"
+
+// Event is a typed record of something that happened in a game.
+// Every event goes to the bot as a single "event <json>" line,
+// and results are appended to the results ledger on disk.
+type Event struct {
+	Game      string            `json:"game"`
+	Player    string            `json:"player,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Payout    *big.Int          `json:"payout,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+
+	status bool // for the bot only, it isn't a result
+}
+
+var pending chan Event
+var subscribers []func(Event)
+var subLock sync.Mutex
+
+// Load starts forwarding emitted events to the bot over wc
+// and into the ledger. Events are sent in the order emitted.
+func Load(wc chan string) {
+	pending = make(chan Event, pendingBuffer)
+	go forward(wc)
+}
+
+func New(game, player, outcome string) Event {
+	return Event{
+		Game:     game,
+		Player:   player,
+		Outcome:  outcome,
+		Metadata: map[string]string{},
+	}
+}
+
+// WithPayout sets the payout for the event
+func (e Event) WithPayout(payout *big.Int) Event {
+	e.Payout = new(big.Int).Set(payout)
+	return e
+}
+
+// Status marks the event as a status update for the bot rather
+// than a result, so it's kept out of the ledger
+func (e Event) Status() Event {
+	e.status = true
+	return e
+}
+
+// With adds a metadata entry to the event
+func (e Event) With(key string, value interface{}) Event {
+	if e.Metadata == nil {
+		e.Metadata = map[string]string{}
+	}
+	e.Metadata[key] = fmt.Sprint(value)
+	return e
+}
+
+// Emit timestamps the event, hands it to any subscribers and
+// queues it for the ledger and the bot. It won't block the caller
+// unless writing the ledger has fallen far behind.
+func Emit(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	subLock.Lock()
+	subs := subscribers
+	subLock.Unlock()
+	for _, f := range subs {
+		f(e)
+	}
+	if pending == nil {
+		return
+	}
+	pending <- e
+}
+
+// Subscribe registers f to be called with every emitted event.
+// f may be called from any goroutine.
+func Subscribe(f func(Event)) {
+	subLock.Lock()
+	defer subLock.Unlock()
+	subscribers = append(subscribers, f)
+}
+
+// String gets the line sent to the bot for the event
+func (e Event) String() string {
+	return fmt.Sprintf("event %s\n", e.json())
+}
+
+func (e Event) json() []byte {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		log.Println("couldn't marshal event", err.Error())
+		return []byte("{}")
+	}
+	return bs
+}
+
+// forward writes results to the ledger and passes every event
+// on to the bot. Events wait in a backlog for as long as the bot
+// isn't reading, so writing the ledger never waits on the bot and
+// the bot never misses a payout.
+func forward(wc chan string) {
+	var lock sync.Mutex
+	backlog := []string{}
+	more := make(chan bool, 1)
+	go func() {
+		for range more {
+			lock.Lock()
+			lines := backlog
+			backlog = nil
+			lock.Unlock()
+			for _, line := range lines {
+				wc <- line
+			}
+		}
+	}()
+	for e := range pending {
+		if !e.status {
+			appendToLedger(e)
+		}
+		lock.Lock()
+		backlog = append(backlog, e.String())
+		if len(backlog)%backlogWarn == 0 {
+			log.Println("bot isn't reading events,", len(backlog), "waiting")
+		}
+		lock.Unlock()
+		select {
+		case more <- true:
+		default:
+		}
+	}
+}
+
+func appendToLedger(e Event) {
+	f, err := os.OpenFile(ledgerPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("couldn't open results ledger", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(e.json(), '\n')); err != nil {
+		log.Println("couldn't write to results ledger", err.Error())
+	}
+}
@@ -0,0 +1,55 @@
+package events
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLedgerWithoutBot(t *testing.T) {
+	ledgerPath = filepath.Join(t.TempDir(), "ledger.jsonl")
+	// nothing reads this until the end, like when the bot isn't connected
+	wc := make(chan string)
+	Load(wc)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			e := New("test", "", "thing").With("i", i)
+			if i%2 == 1 {
+				e = e.Status()
+			}
+			Emit(e)
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Emit blocked with no bot reading")
+	}
+	lines := 0
+	for wait := 0; wait < 100 && lines < 500; wait++ {
+		bs, _ := os.ReadFile(ledgerPath)
+		lines = bytes.Count(bs, []byte("\n"))
+		time.Sleep(50 * time.Millisecond)
+	}
+	if lines != 500 {
+		t.Errorf("ledger has %d events, want the 500 results", lines)
+	}
+
+	// the bot gets every one of them once it reads, in order
+	for i := 0; i < 1000; i++ {
+		select {
+		case line := <-wc:
+			if want := `"i":"` + strconv.Itoa(i) + `"`; !strings.Contains(line, want) {
+				t.Fatalf("event %d was %s", i, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("bot only got %d events", i)
+		}
+	}
+}
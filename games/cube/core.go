@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	"github.com/MattSwanson/burtbot_overlay/sound"
 	"github.com/MattSwanson/burtbot_overlay/speech"
 	rl "github.com/MattSwanson/raylib-go/raylib"
@@ -34,13 +35,11 @@ var highScore int
 var drawSize float32 = 20
 var setDrawSize float32 = 20
 var movesFont rl.Font
-var writeChannel chan string
 var drawOffsetX float32 = 150
 var drawOffsetY float32 = 950
 
-func LoadCubeAssets(wc chan string) {
+func LoadCubeAssets() {
 	movesFont = rl.LoadFontEx("caskaydia.TTF", 72, nil)
-	writeChannel = wc
 }
 
 type cube struct {
@@ -189,6 +188,9 @@ func HandleCommand(args []string) {
 		}
 		// check for completion
 		moveCount++
+		if len(args) > 2 {
+			events.Emit(events.New("cube", args[2], "move").With("move", args[1]).Status())
+		}
 		if checkCube() {
 			fmt.Println("oh joy")
 		}
@@ -833,7 +835,11 @@ func SaveCube() {
 		HighScore:  highScore,
 	}
 	json, _ := json.Marshal(data)
-	writeChannel <- fmt.Sprintf("cube %s\n", string(json))
+	events.Emit(events.New("cube", "", "saved").
+		With("state", string(json)).
+		With("totalMoves", moveCount).
+		With("highScore", highScore).
+		Status())
 	if err := os.WriteFile("cube.json", json, 0644); err != nil {
 		log.Println(err.Error())
 	}
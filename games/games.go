@@ -1,6 +1,12 @@
 package games
 
 import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
 	"github.com/MattSwanson/burtbot_overlay/games/lightsout"
 	"github.com/MattSwanson/burtbot_overlay/games/plinko"
 	"github.com/MattSwanson/burtbot_overlay/games/slots"
@@ -12,6 +18,15 @@ type Game interface {
 	Draw()
 	HandleMessage([]string)
 	Update(float64)
+
+	// Start makes the game active so it gets updated and drawn
+	Start()
+	// Stop ends the game and clears out any state for the round
+	Stop()
+	Active() bool
+	Name() string
+	// Describe gives a short status line for the bot
+	Describe() string
 }
 
 var games map[string]Game = map[string]Game{}
@@ -22,33 +37,215 @@ var drawOrder []string = []string{
 	"plinko",
 }
 
-func Load(screenWidth, screenHeight float64, writeChannel chan string) {
-	games["plinko"] = plinko.Load(screenWidth, screenHeight, writeChannel)
-	games["tanks"] = tanks.Load(screenWidth, screenHeight)
-	games["lightsout"] = lightsout.NewGame(5, 5)
-	games["slots"] = slots.LoadSlots(writeChannel)
+// Games are exclusive by default - only one can be on screen
+// at a time. Pairs listed here stay out of each others way
+// and are allowed to run together.
+var compatible = map[string][]string{
+	"slots":     {"lightsout"},
+	"lightsout": {"slots"},
+}
+
+func Load(screenWidth, screenHeight float64) {
+	register(plinko.Load(screenWidth, screenHeight))
+	register(tanks.Load(screenWidth, screenHeight))
+	register(lightsout.NewGame(5, 5))
+	register(slots.LoadSlots())
+}
+
+func register(g Game) {
+	games[g.Name()] = g
 }
 
 func Draw() {
 	for _, key := range drawOrder {
-		games[key].Draw()
+		if games[key].Active() {
+			games[key].Draw()
+		}
 	}
 }
 
-// Update the games state
+// Update the state of any active games
 func Update(delta float64) {
 	for _, game := range games {
-		game.Update(delta)
+		if game.Active() {
+			game.Update(delta)
+		}
 	}
 }
 
 // First element in the slice should be the name of the
 // game we want to send a message to. If not in the map
-// then ignored
+// then ignored. "start" and "stop" are handled here so
+// the concurrency rules are enforced. A play sent to a game
+// which isn't running tries to start it first, anything else
+// goes to the game as it is.
 func HandleMessage(message []string) {
-	if game, ok := games[message[0]]; ok {
-		game.HandleMessage(message[1:])
+	if message[0] == "game" {
+		handleManagerMessage(message[1:])
+		return
+	}
+	game, ok := games[message[0]]
+	if !ok || len(message) < 2 {
+		return
+	}
+	switch message[1] {
+	case "start":
+		Start(game.Name())
+		return
+	case "stop":
+		Stop(game.Name())
+		return
+	}
+	if p, ok := plays(game.Name(), message[1:]); ok && !start(game.Name(), message[1:], p) {
+		return
+	}
+	game.HandleMessage(message[1:])
+}
+
+// play is a command which starts a game going. player and bet
+// are the args holding who it's for and what they paid, 0 if it
+// doesn't have them, and value is the bet if it's left off.
+type play struct {
+	player int
+	bet    int
+	value  int64
+}
+
+// plays gets the command as a play if it's one which starts the
+// game. Settings, queue checks and the like don't.
+func plays(game string, args []string) (play, bool) {
+	switch game {
+	case "slots":
+		return play{player: 2, bet: 1}, args[0] == "pull"
+	case "plinko":
+		return play{player: 2, bet: 4, value: 1}, args[0] == "drop"
+	case "tanks":
+		if args[0] == "bot" {
+			return play{}, len(args) > 1 && args[1] == "add"
+		}
+		return play{player: 1}, args[0] == "join"
+	case "lightsout":
+		_, err := strconv.Atoi(args[0])
+		return play{player: 1}, err == nil
+	}
+	return play{}, false
+}
+
+// game list
+// game stop <name|all>
+func handleManagerMessage(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "list":
+		running := Running()
+		e := events.New("games", "", "running").With("games", strings.Join(running, " ")).Status()
+		for _, name := range running {
+			e = e.With(name, games[name].Describe())
+		}
+		events.Emit(e)
+	case "stop":
+		if len(args) < 2 {
+			return
+		}
+		if args[1] == "all" {
+			StopAll()
+			return
+		}
+		Stop(args[1])
+	}
+}
+
+// Start the named game if nothing incompatible with it is running.
+// Returns true if the game is running afterwards.
+func Start(name string) bool {
+	return start(name, nil, play{})
+}
+
+// start is Start for a play, which is turned away with its
+// player and bet if the game can't start
+func start(name string, args []string, p play) bool {
+	game, ok := games[name]
+	if !ok {
+		return false
+	}
+	if game.Active() {
+		return true
+	}
+	if blocking := blockedBy(name); len(blocking) > 0 {
+		player := ""
+		if p.player > 0 && len(args) > p.player {
+			player = args[p.player]
+		}
+		e := events.New("games", player, "busy").
+			With("game", name).
+			With("blocking", strings.Join(blocking, " "))
+		if p.bet == 0 {
+			// nothing to refund, so it's just for the bot
+			e = e.Status()
+		} else {
+			// the bet is there so the bot can refund it
+			bet := big.NewInt(p.value)
+			if len(args) > p.bet {
+				if _, err := fmt.Sscan(args[p.bet], bet); err != nil {
+					bet.SetInt64(p.value)
+				}
+			}
+			e = e.WithPayout(bet).With("bet", bet)
+		}
+		events.Emit(e)
+		return false
+	}
+	game.Start()
+	return true
+}
+
+func Stop(name string) {
+	game, ok := games[name]
+	if !ok || !game.Active() {
+		return
+	}
+	game.Stop()
+	events.Emit(events.New("games", "", "stopped").With("game", name))
+}
+
+func StopAll() {
+	for _, name := range Running() {
+		Stop(name)
+	}
+}
+
+// Running gets the names of the active games in draw order
+func Running() []string {
+	names := []string{}
+	for _, name := range drawOrder {
+		if games[name].Active() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// blockedBy gets the running games which can't share
+// the screen with the named game
+func blockedBy(name string) []string {
+	blocking := []string{}
+	for _, other := range Running() {
+		if other != name && !canRunWith(name, other) {
+			blocking = append(blocking, other)
+		}
+	}
+	return blocking
+}
+
+func canRunWith(a, b string) bool {
+	for _, name := range compatible[a] {
+		if name == b {
+			return true
+		}
 	}
+	return false
 }
 
 func Cleanup() {
@@ -0,0 +1,118 @@
+package games
+
+import (
+	"os"
+	"testing"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	"github.com/MattSwanson/burtbot_overlay/games/slots"
+)
+
+// idle stands in for the games which need a window to load
+type idle struct {
+	name   string
+	active bool
+}
+
+func (g *idle) Cleanup()               {}
+func (g *idle) Draw()                  {}
+func (g *idle) HandleMessage([]string) {}
+func (g *idle) Update(float64)         {}
+func (g *idle) Start()                 { g.active = true }
+func (g *idle) Stop()                  { g.active = false }
+func (g *idle) Active() bool           { return g.active }
+func (g *idle) Name() string           { return g.name }
+func (g *idle) Describe() string       { return "idle" }
+
+var emitted []events.Event
+
+func init() {
+	events.Subscribe(func(e events.Event) {
+		emitted = append(emitted, e)
+	})
+}
+
+// loadSlots registers the real slots alongside idle games and
+// returns whatever it emits from then on
+func loadSlots(t *testing.T) *[]events.Event {
+	// the machines load from where the overlay runs
+	wd, _ := os.Getwd()
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	games = map[string]Game{}
+	for _, name := range drawOrder {
+		register(&idle{name: name})
+	}
+	register(slots.LoadSlots())
+	emitted = nil
+	return &emitted
+}
+
+func outcomes(evs []events.Event, game string) []string {
+	got := []string{}
+	for _, e := range evs {
+		if e.Game == game {
+			got = append(got, e.Outcome)
+		}
+	}
+	return got
+}
+
+func TestSlotsMachineThroughManager(t *testing.T) {
+	got := loadSlots(t)
+	HandleMessage([]string{"slots", "machine", "wilds"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "machine_changed" || (*got)[0].Metadata["machine"] != "wilds" {
+		t.Fatalf("changing machine emitted %v", *got)
+	}
+	if games["slots"].Active() {
+		t.Fatal("changing machine started slots")
+	}
+	*got = nil
+	HandleMessage([]string{"slots", "pull", "10", "tester"})
+	HandleMessage([]string{"slots", "machine", "classic"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "machine_busy" {
+		t.Errorf("changing machine mid spin emitted %v", o)
+	}
+}
+
+func TestSlotsModeThroughManager(t *testing.T) {
+	got := loadSlots(t)
+	HandleMessage([]string{"slots", "mode", "video"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "machine_changed" || (*got)[0].Metadata["machine"] != "video" {
+		t.Fatalf("video mode emitted %v", *got)
+	}
+	*got = nil
+	HandleMessage([]string{"slots", "mode", "pachinko"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "mode_invalid" {
+		t.Errorf("unknown mode emitted %v", o)
+	}
+	*got = nil
+	HandleMessage([]string{"slots", "pull", "10", "tester", "5"})
+	HandleMessage([]string{"slots", "mode", "classic"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "machine_busy" {
+		t.Errorf("changing mode mid spin emitted %v", o)
+	}
+	if d := games["slots"].Describe(); d != "spinning for tester, bet 10, 0 queued" {
+		t.Errorf("slots is %q", d)
+	}
+}
+
+func TestBusyCarriesTheBet(t *testing.T) {
+	got := loadSlots(t)
+	Start("plinko")
+	HandleMessage([]string{"slots", "machine", "wilds"})
+	HandleMessage([]string{"slots", "pull", "10", "tester"})
+	if o := outcomes(*got, "slots"); len(o) != 1 || o[0] != "machine_changed" {
+		t.Errorf("slots emitted %v alongside plinko", o)
+	}
+	busy := outcomes(*got, "games")
+	if len(busy) != 1 || busy[0] != "busy" {
+		t.Fatalf("games emitted %v", busy)
+	}
+	e := (*got)[len(*got)-1]
+	if e.Player != "tester" || e.Payout == nil || e.Payout.Int64() != 10 {
+		t.Errorf("busy went to %q with payout %v, want tester with 10", e.Player, e.Payout)
+	}
+}
@@ -2,24 +2,57 @@ package lightsout
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
 const (
-	gameHeight = 1000
-	gameWidth  = 1000
+	gameHeight   = 1000
+	gameWidth    = 1000
+	winShowTime  = 10_000 // ms before the next puzzle
+	hintShowTime = 10_000 // ms
+	creditsShown = 5
 )
 
+var rng *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
 type Core struct {
 	gameBoard      []*light
-	numColumns     int
-	numRows        int
+	rules          rules
+	start          []int // the puzzle as it was set up, for resets
 	currentPuzzle  int
 	puzzleComplete bool
 	running        bool
+	difficulty     string
+	winTime        float64 // ms since the puzzle was solved
+	hint           int     // light to press, -1 for none
+	hintTime       float64
+	moves          int
+	par            int            // fewest presses it could be done in, -1 if it can't
+	presses        map[string]int // by player
+	solvedBy       string
+	generated      chan puzzle // from the generator goroutine
+	generating     bool
+}
+
+// puzzle is a generated board waiting to be played
+type puzzle struct {
+	rules      rules
+	difficulty string
+	state      []int
+}
+
+// credit is how many of the presses a player made
+type credit struct {
+	player  string
+	presses int
 }
 
 var puzzles = [][]int{
@@ -47,26 +80,62 @@ var puzzles = [][]int{
 }
 
 func NewGame(w, h int) *Core {
+	r := rules{w: w, h: h, states: 2}
+	return &Core{
+		gameBoard:  newBoard(r),
+		rules:      r,
+		difficulty: defaultDifficulty,
+		hint:       -1,
+		presses:    map[string]int{},
+		generated:  make(chan puzzle, 1),
+	}
+}
+
+// newBoard lays out square lights, as big as fit, in the middle of
+// the screen
+func newBoard(r rules) []*light {
 	gameBoard := []*light{}
-	leftEdge := (rl.GetScreenWidth() - gameWidth) / 2
-	topEdge := (rl.GetScreenHeight() - gameHeight) / 2
-	lightWidth := gameWidth / w
-	lightHeight := gameHeight / h
-	for i := 0; i < w*h; i++ {
-		x := leftEdge + lightWidth*(i%w)
-		y := topEdge + lightHeight*(i/h)
-		l := NewLight(int32(x), int32(y), int32(lightWidth), int32(lightHeight))
-		gameBoard = append(gameBoard, l)
+	size := gameWidth / r.w
+	if gameHeight/r.h < size {
+		size = gameHeight / r.h
 	}
-	return &Core{
-		gameBoard:  gameBoard,
-		numColumns: w,
-		numRows:    h,
+	leftEdge := (rl.GetScreenWidth() - size*r.w) / 2
+	topEdge := (rl.GetScreenHeight() - size*r.h) / 2
+	for i := 0; i < r.lights(); i++ {
+		x := leftEdge + size*(i%r.w)
+		y := topEdge + size*(i/r.w)
+		l := NewLight(int32(x), int32(y), int32(size), int32(size))
+		gameBoard = append(gameBoard, l)
 	}
+	return gameBoard
 }
 
 func (c *Core) Update(delta float64) {
-
+	select {
+	case p := <-c.generated:
+		c.generating = false
+		c.setPuzzle(p)
+	default:
+	}
+	if c.hint >= 0 {
+		c.hintTime += delta
+		if c.hintTime >= hintShowTime {
+			c.hint = -1
+		}
+	}
+	if !c.puzzleComplete || c.generating {
+		return
+	}
+	c.winTime += delta
+	if c.winTime < winShowTime {
+		return
+	}
+	c.currentPuzzle++
+	if c.currentPuzzle < len(puzzles) && c.rules == classic {
+		c.LoadPuzzle(c.currentPuzzle)
+		return
+	}
+	c.newPuzzle(c.rules, c.difficulty)
 }
 
 func (c *Core) Cleanup() {
@@ -74,90 +143,274 @@ func (c *Core) Cleanup() {
 }
 
 func (c *Core) HandleMessage(args []string) {
-	if args[0] == "start" && !c.running {
-		c.LoadPuzzle(0)
-		c.running = true
-		return
-	}
 	if !c.running {
 		return
 	}
-	if args[0] == "reset" {
-		c.Reset()
+	switch args[0] {
+	case "reset":
+		c.restart()
 		return
-	}
-	if args[0] == "stop" {
-		c.running = false
+	case "hint":
+		c.showHint()
+		return
+	case "new":
+		c.handleNew(args[1:])
 		return
 	}
 	n, err := strconv.Atoi(args[0])
 	if err != nil {
 		return
 	}
-	c.Press(n)
+	// !lo <light> username
+	// every press has to be someone's so the credit adds up
+	if len(args) < 2 || args[1] == "" {
+		events.Emit(events.New("lightsout", "", "press_rejected").
+			With("light", n).
+			With("reason", "no_player"))
+		return
+	}
+	c.Press(n, args[1])
+}
+
+func (c *Core) Start() {
+	c.currentPuzzle = 0
+	if c.rules == classic {
+		c.LoadPuzzle(0)
+	} else {
+		c.newPuzzle(c.rules, c.difficulty)
+	}
+	c.running = true
+}
+
+func (c *Core) Stop() {
+	c.running = false
+}
+
+func (c *Core) Active() bool {
+	return c.running
+}
+
+func (c *Core) Name() string {
+	return "lightsout"
+}
+
+func (c *Core) Describe() string {
+	if c.puzzleComplete {
+		return fmt.Sprintf("puzzle %d solved in %d, par %d", c.currentPuzzle+1, c.moves, c.par)
+	}
+	return fmt.Sprintf("puzzle %d, %s %s, %d moves, par %d", c.currentPuzzle+1, c.rules, c.difficulty, c.moves, c.par)
 }
 
 func (c *Core) Reset() {
 	c.puzzleComplete = false
+	c.winTime = 0
+	c.hint = -1
+	c.moves = 0
+	c.presses = map[string]int{}
+	c.solvedBy = ""
 	for _, l := range c.gameBoard {
-		l.on = false
+		l.state = 0
 	}
 }
 
-func (c *Core) LoadPuzzle(i int) {
+// begin sets the lights up for a new puzzle and works out its par
+func (c *Core) begin(state []int) {
 	c.Reset()
-	for k, n := range puzzles[i] {
-		if n == 1 {
-			c.gameBoard[k].on = true
+	c.start = append([]int{}, state...)
+	for k, s := range state {
+		c.gameBoard[k].state = s
+	}
+	c.par = -1
+	if presses, ok := c.rules.solve(state); ok {
+		c.par = total(presses)
+	}
+}
+
+// !lo reset
+// puts the puzzle back how it started
+func (c *Core) restart() {
+	if len(c.start) != len(c.gameBoard) {
+		c.Reset()
+		return
+	}
+	c.begin(c.start)
+}
+
+// !lo new [easy|medium|hard] [size|WxH] [flat|torus] [2state|3state]
+// anything left out stays how the last puzzle had it
+func (c *Core) handleNew(args []string) {
+	r, difficulty := c.rules, c.difficulty
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		if w, h, ok := parseSize(arg); ok {
+			if w < minSize || w > maxSize || h < minSize || h > maxSize {
+				return
+			}
+			r.w, r.h = w, h
+			continue
 		}
+		switch arg {
+		case "flat":
+			r.torus = false
+		case "torus":
+			r.torus = true
+		case "2state":
+			r.states = 2
+		case "3state":
+			r.states = 3
+		default:
+			if _, ok := difficulties[arg]; !ok {
+				events.Emit(events.New("lightsout", "", "new_rejected").
+					With("reason", "unknown").
+					With("difficulties", strings.Join(difficultyNames(), " ")).
+					With("variants", "flat torus 2state 3state"))
+				return
+			}
+			difficulty = arg
+		}
+	}
+	reason := ""
+	if c.generating {
+		reason = "generating"
+	} else if !r.minimisable() {
+		// there'd be no knowing the par
+		reason = "too_many_solutions"
+	}
+	if reason != "" {
+		events.Emit(events.New("lightsout", "", "new_rejected").
+			With("reason", reason).
+			With("variant", r.String()))
+		return
+	}
+	c.difficulty = difficulty
+	c.newPuzzle(r, difficulty)
+}
+
+// parseSize reads 7 as 7x7, or 7x5 as 7 wide and 5 high
+func parseSize(arg string) (int, int, bool) {
+	ws, hs, found := strings.Cut(arg, "x")
+	w, err := strconv.Atoi(ws)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !found {
+		return w, w, true
 	}
+	h, err := strconv.Atoi(hs)
+	if err != nil {
+		return 0, 0, false
+	}
+	return w, h, true
 }
 
-func (c *Core) Press(pos int) {
-	if pos >= c.numColumns*c.numRows || pos < 0 {
+// newPuzzle starts generating a puzzle with the given rules, Update
+// puts it on the board when it's ready
+func (c *Core) newPuzzle(r rules, difficulty string) {
+	if c.generating {
 		return
 	}
-	c.gameBoard[pos].Toggle()
-	// Then toggle adjacent lights
-	// up
-	if pos/c.numRows != 0 {
-		c.gameBoard[pos-c.numColumns].Toggle()
+	c.generating = true
+	seed := rng.Int63()
+	go func() {
+		c.generated <- puzzle{r, difficulty, generate(r, difficulty, rand.New(rand.NewSource(seed)))}
+	}()
+}
+
+func (c *Core) setPuzzle(p puzzle) {
+	r, difficulty := p.rules, p.difficulty
+	if r.w != c.rules.w || r.h != c.rules.h || len(c.gameBoard) != r.lights() {
+		c.gameBoard = newBoard(r)
 	}
-	// left
-	if pos%c.numColumns != 0 {
-		c.gameBoard[pos-1].Toggle()
+	c.rules = r
+	c.begin(p.state)
+	events.Emit(events.New("lightsout", "", "new_puzzle").
+		With("size", fmt.Sprintf("%dx%d", r.w, r.h)).
+		With("torus", r.torus).
+		With("states", r.states).
+		With("difficulty", difficulty).
+		With("par", c.par))
+}
+
+func (c *Core) lights() []int {
+	state := make([]int, len(c.gameBoard))
+	for i, l := range c.gameBoard {
+		state[i] = l.state
 	}
-	// down
-	if pos/c.numRows < c.numRows-1 {
-		c.gameBoard[pos+c.numColumns].Toggle()
+	return state
+}
+
+// !lo hint
+// lights up one of the presses from the shortest solution
+func (c *Core) showHint() {
+	if c.puzzleComplete {
+		return
 	}
-	// right
-	if pos%c.numColumns != c.numColumns-1 {
-		c.gameBoard[pos+1].Toggle()
+	presses, ok := c.rules.solve(c.lights())
+	if !ok {
+		events.Emit(events.New("lightsout", "", "hint").With("solvable", false).Status())
+		return
 	}
-	if CheckForWin(c.gameBoard) {
-		// wind screen
-		c.puzzleComplete = true
-		go func() {
-			time.Sleep(time.Second * 10)
-			c.currentPuzzle++
-			if c.currentPuzzle >= len(puzzles) {
-				// Gug?
-				fmt.Println("add more puzzles scrub. yeah you.")
-			} else {
-				c.LoadPuzzle(c.currentPuzzle)
-			}
-		}()
+	pressed := []int{}
+	for pos, n := range presses {
+		if n > 0 {
+			pressed = append(pressed, pos)
+		}
 	}
+	c.hint = pressed[rng.Intn(len(pressed))]
+	c.hintTime = 0
+	events.Emit(events.New("lightsout", "", "hint").
+		With("solvable", true).
+		With("press", c.hint).
+		With("remaining", total(presses)).
+		Status())
+}
+
+func (c *Core) LoadPuzzle(i int) {
+	c.begin(puzzles[i])
 }
 
-func CheckForWin(board []*light) bool {
-	for _, l := range board {
-		if !l.on {
-			return false
+// Press moves on the light and its neighbours, crediting the press
+// to the player if there is one
+func (c *Core) Press(pos int, player string) {
+	if pos >= c.rules.lights() || pos < 0 || c.puzzleComplete {
+		return
+	}
+	c.hint = -1
+	for _, l := range c.rules.toggled(pos) {
+		c.gameBoard[l].press(c.rules.states)
+	}
+	c.moves++
+	c.presses[player]++
+	if c.rules.solved(c.lights()) {
+		// win screen, Update moves on to the next puzzle
+		c.puzzleComplete = true
+		c.winTime = 0
+		c.solvedBy = player
+		credit := []string{}
+		for _, cr := range c.credits() {
+			credit = append(credit, fmt.Sprintf("%s:%d", cr.player, cr.presses))
 		}
+		events.Emit(events.New("lightsout", player, "solved").
+			With("moves", c.moves).
+			With("par", c.par).
+			With("credit", strings.Join(credit, " ")).
+			With("variant", c.rules.String()))
+	}
+}
+
+// credits lists who pressed what, most presses first
+func (c *Core) credits() []credit {
+	credits := []credit{}
+	for player, n := range c.presses {
+		credits = append(credits, credit{player, n})
 	}
-	return true
+	sort.Slice(credits, func(i, j int) bool {
+		if credits[i].presses != credits[j].presses {
+			return credits[i].presses > credits[j].presses
+		}
+		return credits[i].player < credits[j].player
+	})
+	return credits
 }
 
 func (c *Core) Draw() {
@@ -165,33 +418,84 @@ func (c *Core) Draw() {
 		return
 	}
 	for k, l := range c.gameBoard {
-		l.Draw()
-		// x, y := k%c.numColumns, k/c.numRows
+		l.Draw(c.rules.states)
 		rl.DrawText(fmt.Sprint(k), l.x, l.y, 18, rl.Green)
 	}
+	if c.hint >= 0 {
+		l := c.gameBoard[c.hint]
+		pulse := float32(0.5 + 0.5*math.Sin(c.hintTime/150))
+		rl.DrawRectangleLinesEx(rl.Rectangle{X: float32(l.x), Y: float32(l.y), Width: float32(l.w), Height: float32(l.h)},
+			8, rl.Fade(rl.Yellow, 0.4+0.6*pulse))
+	}
+	c.drawScore()
 	if c.puzzleComplete {
-		rl.DrawText("winrar", 400, 500, 96, rl.Color{R: 0x55, G: 0xBA, B: 0x2C, A: 0xFF})
+		c.drawWin()
+	}
+}
+
+// drawScore shows the rules and how it's going beside the board
+func (c *Core) drawScore() {
+	last := c.gameBoard[len(c.gameBoard)-1]
+	x, y := last.x+last.w+40, c.gameBoard[0].y
+	rl.DrawText(fmt.Sprintf("%s %s", c.rules, c.difficulty), x, y, 32, rl.White)
+	par := "?"
+	if c.par >= 0 {
+		par = fmt.Sprint(c.par)
+	}
+	rl.DrawText(fmt.Sprintf("moves %d / par %s", c.moves, par), x, y+40, 32, rl.White)
+	for i, cr := range c.credits() {
+		if i == creditsShown {
+			break
+		}
+		rl.DrawText(fmt.Sprintf("%s - %d", cr.player, cr.presses), x, y+100+int32(i)*32, 28, rl.LightGray)
+	}
+}
+
+func (c *Core) drawWin() {
+	green := rl.Color{R: 0x55, G: 0xBA, B: 0x2C, A: 0xFF}
+	cx := int32(rl.GetScreenWidth() / 2)
+	y := int32(rl.GetScreenHeight()/2) - 150
+	rl.DrawRectangle(cx-400, y-30, 800, 430, rl.Fade(rl.Black, 0.8))
+	centered := func(s string, y, size int32, color rl.Color) {
+		rl.DrawText(s, cx-rl.MeasureText(s, size)/2, y, size, color)
+	}
+	centered("SOLVED", y, 96, green)
+	result := fmt.Sprintf("%d moves, par %d", c.moves, c.par)
+	if c.moves <= c.par {
+		result += " - perfect!"
+	}
+	centered(result, y+110, 40, rl.White)
+	if c.solvedBy != "" {
+		centered("last press by "+c.solvedBy, y+160, 32, rl.LightGray)
+	}
+	for i, cr := range c.credits() {
+		if i == creditsShown {
+			break
+		}
+		centered(fmt.Sprintf("%s - %d", cr.player, cr.presses), y+210+int32(i)*36, 32, rl.Gold)
 	}
 }
 
 type light struct {
-	x  int32
-	y  int32
-	w  int32
-	h  int32
-	on bool
+	x     int32
+	y     int32
+	w     int32
+	h     int32
+	state int // 0 is off
 }
 
 func NewLight(x, y, w, h int32) *light {
-	return &light{x, y, w, h, false}
+	return &light{x, y, w, h, 0}
 }
 
-func (l *light) Toggle() {
-	l.on = !l.on
+// press moves the light on to its next state
+func (l *light) press(states int) {
+	l.state = (l.state + 1) % states
 }
 
-func (l *light) Draw() {
-	if l.on {
-		rl.DrawRectangle(l.x, l.y, l.w, l.h, rl.Red)
+// Draw fills the light brighter the further on it is
+func (l *light) Draw(states int) {
+	if l.state > 0 {
+		rl.DrawRectangle(l.x, l.y, l.w, l.h, rl.Fade(rl.Red, float32(l.state)/float32(states-1)))
 	}
 }
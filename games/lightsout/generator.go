@@ -0,0 +1,79 @@
+package lightsout
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	defaultDifficulty = "medium"
+	minSize           = 3
+	maxSize           = 10
+	generateTries     = 200
+	// some rules can't reach the harder difficulties at all, so
+	// give up on getting it right after this long
+	generateTime = 500 * time.Millisecond
+)
+
+// how many presses the best solution takes, as a share of the
+// lights. Three state boards can need two presses on a light.
+var difficulties = map[string]struct{ min, max float64 }{
+	"easy":   {0.1, 0.25},
+	"medium": {0.25, 0.4},
+	"hard":   {0.4, 2},
+}
+
+func difficultyNames() []string {
+	names := []string{}
+	for name := range difficulties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generate makes a puzzle by pressing lights on a solved board so
+// there's always a way back, trying until the fewest presses it
+// takes suits the difficulty. If nothing does it gives the closest.
+// Big boards take a while so this shouldn't be on the main thread.
+func generate(r rules, difficulty string, rng *rand.Rand) []int {
+	d, ok := difficulties[difficulty]
+	if !ok {
+		d = difficulties[defaultDifficulty]
+	}
+	n := r.lights()
+	lo := int(math.Max(1, math.Ceil(d.min*float64(n))))
+	hi := int(math.Max(float64(lo), math.Floor(d.max*float64(n))))
+	// how many different lights to press to start with
+	most := int(math.Min(float64(hi), float64(n)))
+	var closest []int
+	closestBy := math.MaxInt32
+	start := time.Now()
+	for try := 0; try < generateTries && time.Since(start) < generateTime; try++ {
+		state := make([]int, n)
+		for i := range state {
+			state[i] = r.lit()
+		}
+		for _, p := range rng.Perm(n)[:lo+rng.Intn(most-lo+1)] {
+			for times := 1 + rng.Intn(r.states-1); times > 0; times-- {
+				r.press(state, p)
+			}
+		}
+		presses, _ := r.solve(state)
+		by, t := 0, total(presses)
+		if t < lo {
+			by = lo - t
+		} else if t > hi {
+			by = t - hi
+		}
+		if by == 0 {
+			return state
+		}
+		if by < closestBy {
+			closest, closestBy = state, by
+		}
+	}
+	return closest
+}
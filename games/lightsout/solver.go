@@ -0,0 +1,238 @@
+package lightsout
+
+import "fmt"
+
+// past this many combinations of free presses the solver stops
+// looking for the fewest and settles for any solution
+const maxCombinations = 1 << 16
+
+// rules is the shape of a board and how its lights behave
+type rules struct {
+	w, h   int
+	torus  bool // presses wrap round the edges
+	states int  // 2 is plain off and on, 3 goes off, dim, lit
+}
+
+var classic = rules{w: 5, h: 5, states: 2}
+
+func (r rules) lights() int {
+	return r.w * r.h
+}
+
+// lit is the state every light has to reach
+func (r rules) lit() int {
+	return r.states - 1
+}
+
+func (r rules) String() string {
+	s := fmt.Sprintf("%dx%d", r.w, r.h)
+	if r.torus {
+		s += " torus"
+	}
+	if r.states > 2 {
+		s += fmt.Sprintf(" %d-state", r.states)
+	}
+	return s
+}
+
+// toggled gets the lights a press moves on: itself and the ones
+// above, below, left and right of it, wrapping round on a torus
+func (r rules) toggled(pos int) []int {
+	x, y := pos%r.w, pos/r.w
+	lights := []int{pos}
+	neighbour := func(dx, dy int) {
+		nx, ny := x+dx, y+dy
+		if r.torus {
+			nx, ny = (nx+r.w)%r.w, (ny+r.h)%r.h
+		} else if nx < 0 || ny < 0 || nx >= r.w || ny >= r.h {
+			return
+		}
+		lights = append(lights, ny*r.w+nx)
+	}
+	neighbour(0, -1)
+	neighbour(-1, 0)
+	neighbour(0, 1)
+	neighbour(1, 0)
+	return lights
+}
+
+// press moves each light a press touches on to its next state
+func (r rules) press(state []int, pos int) {
+	for _, l := range r.toggled(pos) {
+		state[l] = (state[l] + 1) % r.states
+	}
+}
+
+func (r rules) solved(state []int) bool {
+	for _, s := range state {
+		if s != r.lit() {
+			return false
+		}
+	}
+	return true
+}
+
+// solve finds the fewest presses which light every light fully, by
+// gaussian elimination mod the number of states (2 or 3, both prime
+// so every number has an inverse). The order of presses doesn't
+// matter and pressing a light states times does nothing, so a
+// solution is how many times to press each light. Returns false if
+// there's no way to do it.
+func (r rules) solve(state []int) ([]int, bool) {
+	n, p := r.lights(), r.states
+	rows := r.matrix(state)
+	pivots := reduce(rows, p)
+	// anything left is all zeros, which had better not need moving
+	for i := len(pivots); i < n; i++ {
+		if rows[i][n] != 0 {
+			return nil, false
+		}
+	}
+
+	isPivot := make([]bool, n)
+	for _, col := range pivots {
+		isPivot[col] = true
+	}
+	free := []int{}
+	for col := 0; col < n; col++ {
+		if !isPivot[col] {
+			free = append(free, col)
+		}
+	}
+
+	// with none of the free presses
+	best := make([]int, n)
+	for i, col := range pivots {
+		best[col] = rows[i][n]
+	}
+	// every other solution is that with some of the presses which
+	// change nothing added in, look through them all for the fewest
+	if len(free) > 0 && combinations(p, len(free)) <= maxCombinations {
+		nulls := make([][]int, len(free))
+		for f, col := range free {
+			nulls[f] = make([]int, n)
+			nulls[f][col] = 1
+			for i, pc := range pivots {
+				nulls[f][pc] = (p - rows[i][col]) % p
+			}
+		}
+		x := append([]int{}, best...)
+		fewest := total(best)
+		// count through the combinations, adding one more of a free
+		// press each step. p of them is back where it started, so
+		// rolling a digit over needs nothing undoing.
+		digits := make([]int, len(free))
+		for step := 1; step < combinations(p, len(free)); step++ {
+			d := 0
+			for digits[d] == p-1 {
+				digits[d] = 0
+				addMod(x, nulls[d], p)
+				d++
+			}
+			digits[d]++
+			addMod(x, nulls[d], p)
+			if t := total(x); t < fewest {
+				fewest = t
+				best = append(best[:0], x...)
+			}
+		}
+	}
+	return best, true
+}
+
+// minimisable is whether solve can look through every solution for
+// the fewest presses, rather than settling for any
+func (r rules) minimisable() bool {
+	rows := r.matrix(make([]int, r.lights()))
+	return combinations(r.states, r.lights()-len(reduce(rows, r.states))) <= maxCombinations
+}
+
+// matrix has a row for each light: how far each press moves it,
+// and in the last column how far it has to go
+func (r rules) matrix(state []int) [][]int {
+	n, p := r.lights(), r.states
+	rows := make([][]int, n)
+	for i := range rows {
+		rows[i] = make([]int, n+1)
+		rows[i][n] = (r.lit() - state[i] + p) % p
+	}
+	for pos := 0; pos < n; pos++ {
+		for _, l := range r.toggled(pos) {
+			rows[l][pos] = (rows[l][pos] + 1) % p
+		}
+	}
+	return rows
+}
+
+// reduce puts the rows into reduced row echelon form mod p, and
+// gets the column pivoting each of the rows it could
+func reduce(rows [][]int, p int) []int {
+	mod := func(a int) int {
+		return ((a % p) + p) % p
+	}
+	n := len(rows)
+	width := len(rows[0])
+	pivots := []int{}
+	k := 0
+	for col := 0; col < width-1 && k < n; col++ {
+		pivot := -1
+		for i := k; i < n; i++ {
+			if rows[i][col] != 0 {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[k], rows[pivot] = rows[pivot], rows[k]
+		inv := inverse(rows[k][col], p)
+		for j := col; j < width; j++ {
+			rows[k][j] = mod(rows[k][j] * inv)
+		}
+		for i := 0; i < n; i++ {
+			if f := rows[i][col]; i != k && f != 0 {
+				for j := col; j < width; j++ {
+					rows[i][j] = mod(rows[i][j] - f*rows[k][j])
+				}
+			}
+		}
+		pivots = append(pivots, col)
+		k++
+	}
+	return pivots
+}
+
+// combinations is p to the power of free, stopping once it's past
+// maxCombinations
+func combinations(p, free int) int {
+	c := 1
+	for i := 0; i < free && c <= maxCombinations; i++ {
+		c *= p
+	}
+	return c
+}
+
+func inverse(a, p int) int {
+	for b := 1; b < p; b++ {
+		if a*b%p == 1 {
+			return b
+		}
+	}
+	return 0
+}
+
+func addMod(x, y []int, p int) {
+	for i := range x {
+		x[i] = (x[i] + y[i]) % p
+	}
+}
+
+// total is how many presses a solution takes
+func total(presses []int) int {
+	t := 0
+	for _, n := range presses {
+		t += n
+	}
+	return t
+}
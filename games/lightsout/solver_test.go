@@ -0,0 +1,268 @@
+package lightsout
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+)
+
+func apply(r rules, state []int, presses []int) {
+	for pos, n := range presses {
+		for ; n > 0; n-- {
+			r.press(state, pos)
+		}
+	}
+}
+
+func TestSolveShippedPuzzles(t *testing.T) {
+	for i, p := range puzzles {
+		state := append([]int{}, p...)
+		presses, ok := classic.solve(state)
+		if !ok {
+			t.Fatalf("puzzle %d has no solution", i)
+		}
+		apply(classic, state, presses)
+		if !classic.solved(state) {
+			t.Errorf("puzzle %d not solved by %v", i, presses)
+		}
+	}
+}
+
+// fewest tries every way of pressing a small board
+func fewest(r rules, state []int) int {
+	n := r.lights()
+	combinations := 1
+	for i := 0; i < n; i++ {
+		combinations *= r.states
+	}
+	best := -1
+	presses := make([]int, n)
+	for c := 0; c < combinations; c++ {
+		for i, v := 0, c; i < n; i, v = i+1, v/r.states {
+			presses[i] = v % r.states
+		}
+		t := total(presses)
+		if best >= 0 && t >= best {
+			continue
+		}
+		b := append([]int{}, state...)
+		apply(r, b, presses)
+		if r.solved(b) {
+			best = t
+		}
+	}
+	return best
+}
+
+func TestSolveIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// 3x3 can solve anything, the others only some boards and in
+	// more than one way
+	for _, r := range []rules{
+		{w: 3, h: 3, states: 2},
+		{w: 4, h: 4, states: 2},
+		{w: 5, h: 3, states: 2},
+		{w: 4, h: 3, torus: true, states: 2},
+		{w: 3, h: 3, torus: true, states: 2},
+		{w: 3, h: 3, states: 3},
+		{w: 3, h: 3, torus: true, states: 3},
+	} {
+		for i := 0; i < 10; i++ {
+			state := make([]int, r.lights())
+			for k := range state {
+				state[k] = rng.Intn(r.states)
+			}
+			presses, ok := r.solve(state)
+			want := fewest(r, state)
+			if !ok {
+				if want >= 0 {
+					t.Errorf("%v %v: said unsolvable but takes %d", r, state, want)
+				}
+				continue
+			}
+			if total(presses) != want {
+				t.Errorf("%v %v: solved in %d presses, best is %d", r, state, total(presses), want)
+			}
+			apply(r, state, presses)
+			if !r.solved(state) {
+				t.Errorf("%v: %v doesn't solve it", r, presses)
+			}
+		}
+	}
+}
+
+func TestToggledWraps(t *testing.T) {
+	flat := rules{w: 4, h: 3, states: 2}
+	if got := flat.toggled(0); len(got) != 3 {
+		t.Errorf("flat corner toggles %v", got)
+	}
+	// the row below the top one starts at w, not h
+	if got := flat.toggled(5); got[1] != 1 || got[3] != 9 {
+		t.Errorf("light 5 on 4x3 toggles %v", got)
+	}
+	torus := rules{w: 4, h: 3, torus: true, states: 2}
+	want := []int{0, 8, 3, 4, 1}
+	for i, l := range torus.toggled(0) {
+		if l != want[i] {
+			t.Fatalf("torus corner toggles %v, want %v", torus.toggled(0), want)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, r := range []rules{
+		{w: 3, h: 3, states: 2},
+		{w: 5, h: 5, states: 2},
+		{w: 7, h: 7, states: 2},
+		{w: 10, h: 10, states: 2},
+		{w: 8, h: 5, states: 2},
+		{w: 6, h: 6, torus: true, states: 2},
+		{w: 5, h: 5, states: 3},
+		{w: 6, h: 4, torus: true, states: 3},
+	} {
+		for _, d := range difficultyNames() {
+			state := generate(r, d, rng)
+			presses, ok := r.solve(state)
+			if !ok || total(presses) == 0 {
+				t.Fatalf("%v %s isn't a puzzle", r, d)
+			}
+			n := float64(r.lights())
+			p := float64(total(presses))
+			// wrapping boards can be undone so many ways that some
+			// never need enough presses to be hard
+			if n >= 25 && !r.torus && (p < difficulties[d].min*n || p > difficulties[d].max*n) {
+				t.Errorf("%v %s takes %v presses", r, d, p)
+			}
+		}
+	}
+}
+
+func TestPressCreditsPlayers(t *testing.T) {
+	var solved []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "lightsout" && e.Outcome == "solved" {
+			solved = append(solved, e)
+		}
+	})
+	r := rules{w: 4, h: 3, states: 3}
+	c := &Core{rules: r, hint: -1, running: true}
+	for i := 0; i < r.lights(); i++ {
+		c.gameBoard = append(c.gameBoard, NewLight(0, 0, 1, 1))
+	}
+	state := make([]int, r.lights())
+	for i := range state {
+		state[i] = r.lit()
+	}
+	// each light takes three presses to come back round
+	apply(r, state, []int{5: 1, 11: 2, 0: 2})
+	c.begin(state)
+	if c.par != 4 {
+		t.Fatalf("par %d, want 4", c.par)
+	}
+	c.HandleMessage([]string{"5", "bob"})
+	c.HandleMessage([]string{"11", "alice"})
+	c.HandleMessage([]string{"0", "carol"})
+	c.HandleMessage([]string{"5", "bob"})
+	if !c.puzzleComplete || c.moves != 4 {
+		t.Fatalf("complete %v after %d moves", c.puzzleComplete, c.moves)
+	}
+	if len(solved) != 1 {
+		t.Fatalf("got %d solved events", len(solved))
+	}
+	e := solved[0]
+	if e.Player != "bob" || e.Metadata["credit"] != "bob:2 alice:1 carol:1" || e.Metadata["moves"] != "4" || e.Metadata["par"] != "4" {
+		t.Errorf("solved event %+v", e)
+	}
+	// presses after the win don't count
+	c.HandleMessage([]string{"0", "alice"})
+	if c.moves != 4 {
+		t.Errorf("pressed a solved board")
+	}
+	c.restart()
+	if c.moves != 0 || c.puzzleComplete || c.rules.solved(c.lights()) {
+		t.Errorf("reset didn't put the puzzle back")
+	}
+}
+
+func TestMinimisable(t *testing.T) {
+	for _, r := range []rules{classic, {w: 10, h: 10, torus: true, states: 2}, {w: 6, h: 4, torus: true, states: 3}} {
+		if !r.minimisable() {
+			t.Errorf("%v should be minimisable", r)
+		}
+	}
+	// 11 free presses, 3^11 ways to use them
+	if r := (rules{w: 8, h: 10, torus: true, states: 3}); r.minimisable() {
+		t.Errorf("%v shouldn't be minimisable", r)
+	}
+}
+
+// hard puzzles don't exist on some boards, that shouldn't make
+// the generator take forever looking
+func TestGenerateGivesUp(t *testing.T) {
+	start := time.Now()
+	r := rules{w: 10, h: 10, torus: true, states: 2}
+	state := generate(r, "hard", rand.New(rand.NewSource(3)))
+	if took := time.Since(start); took > 2*generateTime {
+		t.Errorf("took %v", took)
+	}
+	if presses, ok := r.solve(state); !ok || total(presses) == 0 {
+		t.Error("didn't make a puzzle")
+	}
+}
+
+func TestNewPuzzleOffTheMainThread(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "lightsout" && (e.Outcome == "new_puzzle" || e.Outcome == "new_rejected") {
+			got = append(got, e)
+		}
+	})
+	c := NewGame(5, 5)
+	c.running = true
+	c.HandleMessage([]string{"new", "8x10", "torus", "3state"})
+	if len(got) != 1 || got[0].Metadata["reason"] != "too_many_solutions" || c.generating {
+		t.Fatalf("unminimisable variant gave %v", got)
+	}
+	got = nil
+	c.HandleMessage([]string{"new", "hard", "7x4", "torus"})
+	c.HandleMessage([]string{"new", "easy"})
+	if len(got) != 1 || got[0].Metadata["reason"] != "generating" {
+		t.Fatalf("second new while generating gave %v", got)
+	}
+	got = nil
+	for wait := 0; wait < 200 && c.generating; wait++ {
+		time.Sleep(10 * time.Millisecond)
+		c.Update(10)
+	}
+	want := rules{w: 7, h: 4, torus: true, states: 2}
+	if c.generating || c.rules != want || len(c.gameBoard) != 28 || len(got) != 1 || got[0].Outcome != "new_puzzle" {
+		t.Fatalf("puzzle never arrived, rules %v, events %v", c.rules, got)
+	}
+	if c.par <= 0 || c.rules.solved(c.lights()) {
+		t.Errorf("par %d for %v", c.par, c.lights())
+	}
+}
+
+func TestPressNeedsPlayer(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "lightsout" && e.Outcome == "press_rejected" {
+			got = append(got, e)
+		}
+	})
+	c := NewGame(5, 5)
+	c.running = true
+	before := c.lights()
+	c.HandleMessage([]string{"12"})
+	if len(got) != 1 || c.moves != 0 || fmt.Sprint(c.lights()) != fmt.Sprint(before) {
+		t.Fatalf("anonymous press gave %v and %d moves", got, c.moves)
+	}
+	c.HandleMessage([]string{"12", "tester"})
+	if c.moves != 1 || c.presses["tester"] != 1 {
+		t.Errorf("press by tester made %d moves, credited %v", c.moves, c.presses)
+	}
+}
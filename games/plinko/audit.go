@@ -0,0 +1,319 @@
+package plinko
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+)
+
+const (
+	resultsPath = "./plinko_results.jsonl"
+	pathSpacing = 100.0 // px fallen between path samples
+	// how far a replayed state can be from the record, which has
+	// been through json
+	stateTolerance = 1e-9
+)
+
+// checkpoint is the state of a token at a board time
+type checkpoint struct {
+	Time float64 `json:"t"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	VX   float64 `json:"vx"`
+	VY   float64 `json:"vy"`
+	Spin float64 `json:"spin"`
+	// where the token was going into the first of a run of
+	// contacts, which it got to on its own
+	Before *checkpoint `json:"before,omitempty"`
+}
+
+// near is whether the states match, whenever they were
+func (c checkpoint) near(o checkpoint) bool {
+	return math.Abs(c.X-o.X) <= stateTolerance && math.Abs(c.Y-o.Y) <= stateTolerance &&
+		math.Abs(c.VX-o.VX) <= stateTolerance && math.Abs(c.VY-o.VY) <= stateTolerance &&
+		math.Abs(c.Spin-o.Spin) <= stateTolerance
+}
+
+// segmentError is a stretch of the drop, up to a contact with
+// another token or to the bottom, which the replay doesn't match
+type segmentError struct {
+	segment int
+}
+
+func (e segmentError) Error() string {
+	return fmt.Sprintf("segment %d doesn't match the replay", e.segment)
+}
+
+// dropRecord is everything needed to replay a drop
+type dropRecord struct {
+	DropID      string     `json:"dropID"`
+	Seed        int64      `json:"seed"`
+	Player      string     `json:"player"`
+	Board       string     `json:"board"`
+	BoardHash   string     `json:"boardHash"`
+	Chaos       bool       `json:"chaos"`
+	DropPoint   int        `json:"dropPoint"`
+	Value       *big.Int   `json:"value"`
+	ReleaseTime float64    `json:"releaseTime"` // board ms
+	Start       checkpoint `json:"start"`
+	// taken after each substep with a contact with another token,
+	// which a replay on its own can't reproduce so it picks up
+	// from them
+	Checkpoints  []checkpoint `json:"checkpoints,omitempty"`
+	Path         []int        `json:"path"` // x every pathSpacing down
+	Zone         int          `json:"zone"`
+	Multiplier   int          `json:"multiplier"`
+	Payout       *big.Int     `json:"payout"`
+	SecondChance bool         `json:"secondChance"`
+	AirTime      float64      `json:"airTime"` // ms
+	Timestamp    time.Time    `json:"timestamp"`
+}
+
+func newSeed() int64 {
+	var bs [8]byte
+	if _, err := crand.Read(bs[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(bs[:]) >> 1)
+}
+
+func dropID(seed int64) string {
+	return strconv.FormatInt(seed, 36)
+}
+
+func (t *token) state(time float64) checkpoint {
+	return checkpoint{Time: time, X: t.x, Y: t.y, VX: t.vx, VY: t.vy, Spin: t.spin}
+}
+
+func (t *token) setState(c checkpoint) {
+	t.x, t.y, t.vx, t.vy, t.spin = c.X, c.Y, c.VX, c.VY, c.Spin
+}
+
+// release sets the token falling with everything random about
+// it coming from its seed
+func (bd *board) release(t *token) {
+	rng := rand.New(rand.NewSource(t.seed))
+	t.vx = releaseVelocity(rng.Float64())
+	t.roll = rng.Intn(50)
+	t.falling = true
+	t.releaseTime = bd.time
+	t.start = t.state(bd.time)
+	t.last = t.start
+	t.startValue = new(big.Int).Set(t.Value)
+}
+
+// recordPath should be called at the end of every substep
+func (t *token) recordPath(time float64) {
+	if t.touched {
+		cp := t.state(time)
+		if n := len(t.checkpoints); n == 0 || t.checkpoints[n-1].Time != t.last.Time {
+			before := t.last
+			cp.Before = &before
+		}
+		t.checkpoints = append(t.checkpoints, cp)
+		t.touched = false
+	}
+	t.last = t.state(time)
+	if n := int(t.center().y / pathSpacing); n > len(t.path) {
+		t.path = append(t.path, int(t.center().x))
+	}
+}
+
+func (bd *board) newDropRecord(t *token) *dropRecord {
+	return &dropRecord{
+		DropID:      t.dropID,
+		Seed:        t.seed,
+		Player:      t.playerName,
+		Board:       bd.name,
+		BoardHash:   bd.defHash,
+		Chaos:       bd.chaos,
+		DropPoint:   t.dropPoint,
+		Value:       t.startValue,
+		ReleaseTime: t.releaseTime,
+		Start:       t.start,
+		Checkpoints: t.checkpoints,
+		Path:        t.path,
+		Zone:        bd.zoneIndex(t.zone),
+		AirTime:     t.airTime,
+		Timestamp:   time.Now(),
+	}
+}
+
+func (bd *board) zoneIndex(z *zone) int {
+	for i, bz := range bd.zones {
+		if bz == z {
+			return i
+		}
+	}
+	return -1
+}
+
+func logDrop(r *dropRecord) {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		log.Println("couldn't marshal plinko drop", err.Error())
+		return
+	}
+	f, err := os.OpenFile(resultsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("couldn't open plinko results", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(bs, '\n')); err != nil {
+		log.Println("couldn't write plinko results", err.Error())
+	}
+}
+
+func findDrop(id string) (*dropRecord, error) {
+	f, err := os.Open(resultsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := dropRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.DropID == id {
+			return &r, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no drop %s", id)
+}
+
+// replay re-simulates the drop on its own on a fresh copy of the
+// board, from its seed and drop point, and gets the zone it lands
+// in and what it pays out. The release and second chance roll have
+// to match what the seed gives. Other tokens can't be replayed, so
+// at each contact the replay has to have got to where the token
+// was going in and carries on from where it came out.
+func replay(r *dropRecord, def *boardDef) (int, *big.Int, error) {
+	if def.hash != r.BoardHash {
+		return -1, nil, fmt.Errorf("board %s has changed since the drop", r.Board)
+	}
+	bd, err := def.build()
+	if err != nil {
+		return -1, nil, err
+	}
+	if r.DropPoint < 0 || r.DropPoint >= len(bd.dropPoints) {
+		return -1, nil, fmt.Errorf("board %s has no drop point %d", r.Board, r.DropPoint)
+	}
+	bd.chaos = r.Chaos
+	bd.time = r.ReleaseTime
+	dp := bd.dropPoints[r.DropPoint]
+	t := &token{
+		x:      dp.x,
+		y:      dp.y,
+		radius: tokenRadius,
+		mass:   tokenMass,
+		Value:  new(big.Int).Set(r.Value),
+		seed:   r.Seed,
+	}
+	bd.release(t)
+	if !t.start.near(r.Start) {
+		return -1, nil, errors.New("release doesn't match the seed")
+	}
+	if r.SecondChance && t.roll >= 1 {
+		return -1, nil, errors.New("second chance doesn't match the seed")
+	}
+	// as long as any drop could take, with room to spare
+	next, segment := 0, 0
+	for i := 0; i < 60*60*4; i++ {
+		contact := next < len(r.Checkpoints) && math.Abs(r.Checkpoints[next].Time-(bd.time+substepTime)) < substepTime/2
+		if contact && (next == 0 || r.Checkpoints[next-1].Time != bd.time) {
+			// a run of contacts starts where it got to alone
+			before := r.Checkpoints[next].Before
+			if before == nil || !t.state(bd.time).near(*before) {
+				return -1, nil, segmentError{segment}
+			}
+			segment++
+		}
+		bd.substep([]*token{t}, substepTime)
+		if contact {
+			t.setState(r.Checkpoints[next])
+			next++
+			if t.y > zoneLine {
+				bd.landIn(t)
+			}
+			t.falling = t.y <= gameHeight+50
+		}
+		if !t.falling {
+			if next < len(r.Checkpoints) {
+				// contacts it never got to
+				return -1, nil, segmentError{segment}
+			}
+			if t.zone == nil {
+				return -1, big.NewInt(0), nil
+			}
+			return bd.zoneIndex(t.zone), new(big.Int).Mul(t.Value, big.NewInt(int64(t.zone.rewardValue))), nil
+		}
+	}
+	return -1, nil, errors.New("drop never landed")
+}
+
+func verifyDrop(id string) (*dropRecord, int, *big.Int, error) {
+	r, err := findDrop(id)
+	if err != nil {
+		return nil, -1, nil, err
+	}
+	def, err := readNamedBoardDef(r.Board)
+	if err != nil {
+		return r, -1, nil, err
+	}
+	zone, payout, err := replay(r, def)
+	return r, zone, payout, err
+}
+
+// verify replays the drop from the results log off the main
+// thread and lets the bot know if it comes out the same
+func verify(id string) {
+	go func() {
+		e := events.New("plinko", "", "verify").With("dropID", id)
+		r, zone, payout, err := verifyDrop(id)
+		if r != nil {
+			e.Player = r.Player
+		}
+		var se segmentError
+		if errors.As(err, &se) {
+			events.Emit(e.With("result", "mismatch").
+				With("segment", se.segment).
+				With("recordedZone", r.Zone).
+				With("recordedPayout", r.Payout).
+				With("contacts", len(r.Checkpoints)))
+			return
+		}
+		if err != nil {
+			events.Emit(e.With("result", "error").With("error", err.Error()))
+			return
+		}
+		result := "ok"
+		if zone != r.Zone || payout.Cmp(r.Payout) != 0 {
+			result = "mismatch"
+		}
+		events.Emit(e.WithPayout(payout).
+			With("result", result).
+			With("zone", zone).
+			With("recordedZone", r.Zone).
+			With("recordedPayout", r.Payout).
+			With("contacts", len(r.Checkpoints)))
+	}()
+}
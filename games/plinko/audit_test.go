@@ -0,0 +1,161 @@
+package plinko
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// liveDrops drops a token a second, going along the drop points,
+// or one from every drop point if it's busy, with uneven frame
+// times and gets their records once they've landed
+func liveDrops(t *testing.T, def *boardDef, chaos, busy bool) ([]*dropRecord, []*token) {
+	bd, err := def.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd.chaos = chaos
+	rng := rand.New(rand.NewSource(1))
+	tokens, landed := []*token{}, []*token{}
+	for frame := 0; frame < 5000; frame++ {
+		for i, dp := range bd.dropPoints {
+			if frame%60 != 0 || frame >= 1800 || (!busy && i != frame/60%len(bd.dropPoints)) {
+				continue
+			}
+			tk := &token{
+				x:         dp.x,
+				y:         dp.y,
+				radius:    tokenRadius,
+				mass:      tokenMass,
+				Value:     big.NewInt(1),
+				dropPoint: i,
+				seed:      rng.Int63(),
+			}
+			bd.release(tk)
+			tokens = append(tokens, tk)
+		}
+		var l []*token
+		tokens, l = bd.step(tokens, float64(10+rng.Intn(25)))
+		landed = append(landed, l...)
+	}
+	if len(tokens) > 0 {
+		t.Fatalf("%d tokens never landed", len(tokens))
+	}
+	records := []*dropRecord{}
+	for _, tk := range landed {
+		r := bd.newDropRecord(tk)
+		r.Payout = new(big.Int).Mul(tk.Value, big.NewInt(int64(tk.zone.rewardValue)))
+		records = append(records, r)
+	}
+	return records, landed
+}
+
+// every drop replays to the same zone and payout from its seed,
+// picking up from the checkpoints where it ran into other tokens
+func TestReplayMatchesLive(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chaos := range []bool{false, true} {
+		records, _ := liveDrops(t, def, chaos, true)
+		contested := 0
+		for i, r := range records {
+			zone, payout, err := replay(r, def)
+			if err != nil {
+				t.Fatalf("replaying drop %d: %v", i, err)
+			}
+			if len(r.Checkpoints) > 0 {
+				contested++
+			}
+			if zone != r.Zone || payout.Cmp(r.Payout) != 0 {
+				t.Errorf("drop %d replayed to zone %d paying %s, live was zone %d paying %s", i, zone, payout, r.Zone, r.Payout)
+			}
+		}
+		if contested < len(records)/4 {
+			t.Errorf("only %d of %d drops ran into another token", contested, len(records))
+		}
+	}
+}
+
+func TestReplayCatchesDoctoredLog(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, landed := liveDrops(t, def, false, false)
+	var r *dropRecord
+	for i := range records {
+		if len(records[i].Checkpoints) == 0 && landed[i].roll >= 1 {
+			r = records[i]
+			break
+		}
+	}
+	if r == nil {
+		t.Fatal("no drop fell alone")
+	}
+
+	doctored := *r
+	doctored.Start.VX += 1
+	if _, _, err := replay(&doctored, def); err == nil {
+		t.Error("replayed a release the seed doesn't give")
+	}
+	doctored = *r
+	doctored.Seed++
+	if _, _, err := replay(&doctored, def); err == nil {
+		t.Error("replayed with someone else's seed")
+	}
+	doctored = *r
+	doctored.SecondChance = true
+	if _, _, err := replay(&doctored, def); err == nil {
+		t.Error("gave a second chance the roll didn't")
+	}
+
+	// a contact steering it off somewhere else has to start from
+	// where it really was
+	doctored = *r
+	before := checkpoint{X: 10, Y: 300, VX: -5}
+	doctored.Checkpoints = []checkpoint{{Time: r.ReleaseTime + 1000, X: 10, Y: 300, VX: -5, Before: &before}}
+	var se segmentError
+	if _, _, err := replay(&doctored, def); !errors.As(err, &se) || se.segment != 0 {
+		t.Errorf("replayed a made up contact, got %v", err)
+	}
+}
+
+func TestReplayCatchesDoctoredContact(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := liveDrops(t, def, false, true)
+	var r *dropRecord
+	for _, rec := range records {
+		if len(rec.Checkpoints) > 0 {
+			r = rec
+			break
+		}
+	}
+	if r == nil {
+		t.Fatal("no drop ran into another token")
+	}
+	// knocking it sideways at a contact throws out whatever's after
+	doctored := *r
+	doctored.Checkpoints = append([]checkpoint{}, r.Checkpoints...)
+	doctored.Checkpoints[0].X += 40
+	zone, payout, err := replay(&doctored, def)
+	if err == nil && zone == r.Zone && payout.Cmp(r.Payout) == 0 {
+		t.Error("replay didn't notice the doctored contact")
+	}
+}
+
+func TestReplayRejectsChangedBoard(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &dropRecord{BoardHash: "something else", Value: big.NewInt(1)}
+	if _, _, err := replay(r, def); err == nil {
+		t.Error("replayed on a board which doesn't match the record")
+	}
+}
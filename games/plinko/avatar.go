@@ -0,0 +1,24 @@
+package plinko
+
+import (
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+// player name -> their avatar, which may still be loading
+var avatars = map[string]*imagecache.Image{}
+
+// requestAvatar starts loading the players avatar if it isn't already
+func requestAvatar(player, url string) {
+	if _, ok := avatars[player]; ok || url == "" {
+		return
+	}
+	avatars[player] = imagecache.Get(url)
+}
+
+func avatarFor(player string) (rl.Texture2D, bool) {
+	if img := avatars[player]; img != nil && img.Ready() {
+		return img.Texture(), true
+	}
+	return rl.Texture2D{}, false
+}
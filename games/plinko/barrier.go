@@ -4,6 +4,11 @@ import (
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
+const (
+	barrierWidth  = 128
+	barrierHeight = 64
+)
+
 type barrier struct {
 	x       float64
 	y       float64
@@ -17,8 +22,8 @@ type barrier struct {
 func NewBarrier(sprite rl.Texture2D) *barrier {
 	b := barrier{
 		sprite: sprite,
-		w:      float64(sprite.Width),
-		h:      float64(sprite.Height),
+		w:      barrierWidth,
+		h:      barrierHeight,
 		bounds: []edge{},
 	}
 	return &b
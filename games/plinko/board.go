@@ -0,0 +1,311 @@
+package plinko
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	boardsDir       = "./boards/plinko"
+	defaultBoard    = "classic"
+	pegRadius       = 14.0
+	tokenRadius     = 18.0
+	validationRuns  = 60   // drops per drop point when checking a board
+	validationFrame = 16.0 // ms
+)
+
+// boardDef is the layout of a board as it's stored on disk.
+// All positions are the centers of things in screen space.
+type boardDef struct {
+	Name string `json:"name"`
+	// either a grid of pegs or a list of peg positions
+	PegGrid *pegGrid  `json:"pegGrid,omitempty"`
+	Pegs    []point   `json:"pegs,omitempty"`
+	Zones   []zoneDef `json:"zones"`
+	// x positions of the barriers along the bottom. If left
+	// out there will be one at every zone edge
+	Barriers   []float64 `json:"barriers,omitempty"`
+	DropPoints []point   `json:"dropPoints"`
+
+	Bumpers    []bumperDef    `json:"bumpers,omitempty"`
+	Spinners   []spinnerDef   `json:"spinners,omitempty"`
+	MovingRows []movingRowDef `json:"movingRows,omitempty"`
+	Gates      []gateDef      `json:"gates,omitempty"`
+
+	hash string // of the file it was read from
+}
+
+// pegGrid lays out rows of evenly spaced pegs centered
+// on the screen, with every other row shifted over
+type pegGrid struct {
+	Rows      int     `json:"rows"`
+	Columns   int     `json:"columns"`
+	SpacingX  float64 `json:"spacingX"`
+	SpacingY  float64 `json:"spacingY"`
+	Top       float64 `json:"top"`
+	RowOffset float64 `json:"rowOffset"`
+}
+
+type zoneDef struct {
+	Width      float64 `json:"width"` // relative to the other zones
+	Multiplier int     `json:"multiplier"`
+}
+
+type point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// board is a built layout ready to be played on
+type board struct {
+	name       string
+	pegs       []*peg
+	zones      []*zone
+	barriers   []*barrier
+	dropPoints []fPoint
+	hash       *spatialHash
+
+	// moving pegs aren't in the hash since they don't stay put
+	movingPegs  []*peg
+	bumpers     []*bumper
+	spinners    []*spinner
+	gates       []*gate
+	chaos       bool
+	time        float64 // ms, for anything that moves
+	accumulator float64 // ms not yet simulated
+	defHash     string  // of the file it was loaded from
+}
+
+// loadBoard reads, builds and validates the named board
+func loadBoard(name string) (*board, error) {
+	def, err := readNamedBoardDef(name)
+	if err != nil {
+		return nil, err
+	}
+	if def.Name == "" {
+		def.Name = name
+	}
+	b, err := def.build()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.validate(); err != nil {
+		return nil, fmt.Errorf("board %s %w", name, err)
+	}
+	return b, nil
+}
+
+// validate checks every zone can be landed in, with the chaos
+// obstacles out too if there are any since chaos can be turned
+// on at any time
+func (b *board) validate() error {
+	modes := []bool{false}
+	if b.hasChaos() {
+		modes = append(modes, true)
+	}
+	defer func() { b.chaos = false }()
+	for _, chaos := range modes {
+		b.chaos = chaos
+		if missing := b.unreachableZones(validationRuns); len(missing) > 0 {
+			if chaos {
+				return fmt.Errorf("has unreachable zones %v in chaos rounds", missing)
+			}
+			return fmt.Errorf("has unreachable zones %v", missing)
+		}
+	}
+	return nil
+}
+
+func readNamedBoardDef(name string) (*boardDef, error) {
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid board name %q", name)
+	}
+	return readBoardDef(filepath.Join(boardsDir, name+".json"))
+}
+
+func readBoardDef(path string) (*boardDef, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def := boardDef{}
+	if err := json.Unmarshal(bs, &def); err != nil {
+		return nil, fmt.Errorf("couldn't parse board %s: %w", path, err)
+	}
+	sum := sha256.Sum256(bs)
+	def.hash = hex.EncodeToString(sum[:])
+	return &def, nil
+}
+
+func (d *boardDef) build() (*board, error) {
+	if len(d.Zones) == 0 {
+		return nil, errors.New("board needs at least one zone")
+	}
+	if len(d.DropPoints) == 0 {
+		return nil, errors.New("board needs at least one drop point")
+	}
+	b := &board{
+		name:    d.Name,
+		defHash: d.hash,
+		// leave room for tokens falling out the bottom
+		hash: newSpatialHash(gameWidth, gameHeight+100),
+	}
+
+	pegs := d.Pegs
+	moving := map[int]movingRowDef{}
+	if d.PegGrid != nil {
+		pegs = append(pegs, d.PegGrid.points()...)
+		for _, r := range d.MovingRows {
+			if r.Row < 0 || r.Row >= d.PegGrid.Rows || r.Period <= 0 {
+				return nil, fmt.Errorf("invalid moving row %v", r)
+			}
+			moving[r.Row] = r
+		}
+	} else if len(d.MovingRows) > 0 {
+		return nil, errors.New("moving rows need a peg grid")
+	}
+	for i, p := range pegs {
+		pg := &peg{
+			x:      p.X - pegRadius,
+			y:      p.Y - pegRadius,
+			radius: pegRadius,
+			img:    pegImg,
+		}
+		// grid pegs come after any listed ones, a row at a time
+		if gi := i - len(d.Pegs); gi >= 0 {
+			if r, ok := moving[gi/d.PegGrid.Columns]; ok {
+				pg.baseX = p.X
+				pg.amplitude = r.Amplitude
+				pg.period = r.Period
+				pg.chaos = r.Chaos
+				b.movingPegs = append(b.movingPegs, pg)
+				continue
+			}
+		}
+		b.pegs = append(b.pegs, pg)
+		b.hash.insertPeg(pg)
+	}
+
+	for _, bp := range d.Bumpers {
+		if bp.Radius <= 0 {
+			return nil, fmt.Errorf("invalid bumper %v", bp)
+		}
+		b.bumpers = append(b.bumpers, &bumper{x: bp.X, y: bp.Y, radius: bp.Radius, kick: bp.Kick, chaos: bp.Chaos})
+	}
+	for _, s := range d.Spinners {
+		if s.Length <= 0 {
+			return nil, fmt.Errorf("invalid spinner %v", s)
+		}
+		b.spinners = append(b.spinners, &spinner{x: s.X, y: s.Y, length: s.Length, speed: s.Speed, chaos: s.Chaos})
+	}
+	for _, g := range d.Gates {
+		if g.Width <= 0 || g.Multiplier <= 0 {
+			return nil, fmt.Errorf("invalid gate %v", g)
+		}
+		b.gates = append(b.gates, &gate{x: g.X, y: g.Y, w: g.Width, multiplier: g.Multiplier, chaos: g.Chaos})
+	}
+
+	totalWidth := 0.0
+	for _, z := range d.Zones {
+		if z.Width <= 0 {
+			return nil, errors.New("zone widths must be positive")
+		}
+		totalWidth += z.Width
+	}
+	edges := []float64{0}
+	x := 0.0
+	for _, z := range d.Zones {
+		w := z.Width / totalWidth * gameWidth
+		b.zones = append(b.zones, NewZone(fRect{fPoint{x, gameHeight}, fPoint{x + w, gameHeight + 10}}, z.Multiplier))
+		x += w
+		edges = append(edges, x)
+	}
+
+	barriers := d.Barriers
+	if barriers == nil {
+		barriers = edges
+	}
+	for _, bx := range barriers {
+		br := NewBarrier(barrierImg)
+		br.SetPosition(bx, gameHeight-br.h/2)
+		b.barriers = append(b.barriers, br)
+	}
+
+	for _, p := range d.DropPoints {
+		if p.X < tokenRadius || p.X > gameWidth-tokenRadius {
+			return nil, fmt.Errorf("drop point %v is off the board", p)
+		}
+		b.dropPoints = append(b.dropPoints, fPoint{p.X - tokenRadius, p.Y - tokenRadius})
+	}
+	return b, nil
+}
+
+func (g *pegGrid) points() []point {
+	points := []point{}
+	offset := g.RowOffset
+	for row := 0; row < g.Rows; row++ {
+		offset *= -1
+		for col := 0; col < g.Columns; col++ {
+			points = append(points, point{
+				X: float64(col-g.Columns/2)*g.SpacingX + gameWidth/2 + offset,
+				Y: float64(row)*g.SpacingY + g.Top,
+			})
+		}
+	}
+	return points
+}
+
+// unreachableZones drops tokens from every drop point across the
+// whole range of release speeds and gets the indices of any zones
+// nothing landed in
+func (b *board) unreachableZones(runs int) []int {
+	hit := make([]bool, len(b.zones))
+	rng := rand.New(rand.NewSource(1))
+	for _, dp := range b.dropPoints {
+		for i := 0; i < runs; i++ {
+			// spread the runs evenly over the release range with
+			// a little jitter so we aren't sampling a fixed grid
+			r := (float64(i) + rng.Float64()) / float64(runs)
+			t := &token{x: dp.x, y: dp.y, radius: tokenRadius, mass: tokenMass, falling: true, Value: big.NewInt(1)}
+			t.vx = releaseVelocity(r)
+			if z := b.simulate(t); z >= 0 {
+				hit[z] = true
+			}
+		}
+	}
+	missing := []int{}
+	for i, h := range hit {
+		if !h {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// simulate runs a single token until it lands and gets the
+// index of the zone it landed in, or -1 if it never did
+func (b *board) simulate(t *token) int {
+	tokens := []*token{t}
+	// plenty of time for a token to bounce its way down
+	for i := 0; i < 60*60; i++ {
+		var landed []*token
+		tokens, landed = b.step(tokens, validationFrame)
+		if len(landed) > 0 {
+			for k, z := range b.zones {
+				if z == t.zone {
+					return k
+				}
+			}
+			return -1
+		}
+	}
+	return -1
+}
@@ -8,40 +8,38 @@ import (
 	"log"
 	"math"
 	"math/big"
-	"math/rand"
 	"strconv"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	"github.com/MattSwanson/burtbot_overlay/sound"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
 const (
-	gravity       float64 = 500.0
-	gameHeight    float64 = 1440
-	gameWidth     float64 = 2560
-	numRows       int     = 13
-	numColumns    int     = 25
-	numDropQueues int     = 5
+	gravity    float64 = 500.0
+	gameHeight float64 = 1440
+	gameWidth  float64 = 2560
 )
 
 var tokenImg rl.Texture2D
 var barrierImg rl.Texture2D
+var pegImg rl.Texture2D
 var timerChannel chan bool
 
-var goalValues = []int{1, 0, 2, 1, 0, 5, 0, 1, 2, 0, 1}
-
 type Core struct {
 	lastUpdate       time.Time
 	tokens           []*token
-	pegs             []*peg
-	goalZones        []*zone
-	barriers         []*barrier
+	board            *board
+	pendingBoard     *board
+	boardChannel     chan *board // buffered so the loader never waits on a stopped game
+	loadingBoard     bool
 	queues           []tokenQueue
 	currentDropPoint int
-	rewardMultiplier int
-	writeChannel     chan string
 	CancelTimer      context.CancelFunc
+	running          bool
+	chaos            bool
+	statsTime        float64 // ms left showing the stats
 }
 
 type fPoint struct {
@@ -107,253 +105,155 @@ func (r *fRect) Dy() float64 {
 	return r.max.y - r.min.y
 }
 
-type tokenQueue struct {
-	Tokens       []*token
-	dropPosition fPoint
-}
-
-// push the token to the back of the queue
-func (tq *tokenQueue) push(t *token) {
-	tq.Tokens = append(tq.Tokens, t)
-}
-
-// pop the front element from the front of the queue
-func (tq *tokenQueue) pop() (*token, error) {
-	if len(tq.Tokens) == 0 {
-		return nil, errors.New("nothing in queue")
-	}
-	t := tq.Tokens[0]
-	if len(tq.Tokens) == 1 {
-		tq.Tokens = []*token{}
-	} else {
-		tq.Tokens = tq.Tokens[1:]
-	}
-	return t, nil
-}
-
-func Load(screenWidth, screenHeight float64, wc chan string) *Core {
+func Load(screenWidth, screenHeight float64) *Core {
 	timerChannel = make(chan bool)
 
 	tokenImg = rl.LoadTexture("./images/plinko/new_token.png")
 	barrierImg = rl.LoadTexture("./images/plinko/triangle.png")
+	pegImg = rl.LoadTexture("./images/plinko/token.png")
+	loadStats()
 
-	pegs := generatePegs(screenWidth, screenHeight)
-	tokenQueues := make([]tokenQueue, numDropQueues)
-	for i := 0; i < numDropQueues; i++ {
-		dropPoint := fPoint{(screenWidth/2 - float64(tokenImg.Width)) + float64(i-numDropQueues/2)*300, 20.0}
-		tq := tokenQueue{
-			Tokens:       []*token{},
-			dropPosition: dropPoint,
-		}
-		tokenQueues[i] = tq
+	b, err := loadBoard(defaultBoard)
+	if err != nil {
+		log.Fatal("couldn't load the default plinko board: ", err)
 	}
 
-	tokens := []*token{}
-	//boxes := generateBounds(screenWidth, screenHeight)
-	zones := generateGoalZones()
-	barriers := generateBarriers(len(zones) + 1)
-
 	c := Core{
-		tokens:           tokens,
-		pegs:             pegs,
+		tokens:           []*token{},
 		currentDropPoint: 2,
-		queues:           tokenQueues,
-		barriers:         barriers,
-		goalZones:        zones,
-		writeChannel:     wc,
+		boardChannel:     make(chan *board, 1),
 	}
+	c.setBoard(b)
 	c.CancelTimer = manageQueues()
 	return &c
 }
 
-func (c *Core) CheckForCollision(delta float64) {
-
-	const drain float64 = 0.85
-	for idx, b := range c.tokens {
-		if !b.falling {
-			continue
+// setBoard swaps to the new board, moving anything queued over
+// to the new drop points. Queues past the last drop point are
+// merged into it up to the usual limits and the rest refunded.
+// Should only be done between drops.
+func (c *Core) setBoard(b *board) {
+	queues := make([]tokenQueue, len(b.dropPoints))
+	for i, dp := range b.dropPoints {
+		queues[i] = tokenQueue{
+			Tokens:       []*token{},
+			dropPosition: dp,
 		}
-		// peg collisions
-		for _, peg := range c.pegs {
-			dx := (b.x + b.radius) - (peg.x + peg.radius)
-			dy := (b.y + b.radius) - (peg.y + peg.radius)
-			mag := math.Hypot(dx, dy)
-			vmag := math.Hypot(b.vx, b.vy)
-			if mag <= peg.radius+b.radius {
-				b.vx = (drain * vmag) * (dx / mag)
-				b.vy = (drain * vmag) * (dy / mag)
-				// .05 -> .25
-
-				// to prevent getting "stuck" inside the peg
-				scale := (b.radius + peg.radius + 0.01) / mag
-				ndx := dx * scale
-				ndy := dy * scale
-				b.x = peg.x + peg.radius + ndx - b.radius
-				b.y = peg.y + peg.radius + ndy - b.radius
-				// maybe I should have put the origins at the center of the objects....
-
-				//c.sounds["bip"].SetVolume()
-				//c.sounds["bip"].Rewind()
-				//c.sounds["bip"].Play()
-			}
+	}
+	for i, q := range c.queues {
+		n := i
+		if n >= len(queues) {
+			n = len(queues) - 1
 		}
-
-		// token collisions????
-		for otidx, ot := range c.tokens {
-			if otidx == idx {
+		for _, t := range q.Tokens {
+			if reason := queueLimit(queues, n, t.playerName); reason != "" && t.tokenType != typeSecondChance {
+				events.Emit(events.New("plinko", t.playerName, "queue_rejected").
+					WithPayout(t.Value).
+					With("dropPoint", n).
+					With("reason", reason))
 				continue
 			}
-			dx := b.x - ot.x
-			dy := b.y - ot.y
-
-			// magnitude of the collsion vector
-			mag := math.Hypot(dx, dy)
-
-			if mag <= ot.radius+b.radius {
-				// magnitude of this tokens velocity
-				vmag := math.Hypot(b.vx, b.vy)
-
-				// magnitude of other tokens velocity
-				otvmag := math.Hypot(ot.vx, ot.vy)
-
-				// total velocity of the collision -- masses are equal so no need to worky about that
-				totalVelocity := vmag + otvmag
-
-				b.vx = (drain * totalVelocity) / 2.0 * (dx / mag)
-				b.vy = (drain * totalVelocity) / 2.0 * (dy / mag)
-				ot.vx = (drain * totalVelocity) / 2.0 * (-1.0 * dx / mag)
-				ot.vy = (drain * totalVelocity) / 2.0 * (-1.0 * dy / mag)
-
-				// rl.PlaySoundMulti(c.sounds["boing"])
-			}
-		}
-
-		if b.x <= 0 {
-			b.vy = b.vy * 0.6
-			b.vx = -b.vx * 0.6
-			b.x = 1
-		}
-		if b.x+2*b.radius >= gameWidth {
-			b.vy = b.vy * 0.6
-			b.vx = -b.vx * 0.6
-			b.x = gameWidth - 2*b.radius - 1
-		}
-
-		// barrier collision
-		for _, barrier := range c.barriers {
-			if b.y < 1300 {
-				break
-			}
-			dx := b.x + b.radius - barrier.x
-
-			// which barrier are we closest to?
-
-			if dx > 0 {
-				for i := 0; i <= 6; i++ {
-					// 3.926991
-					a := math.Pi + float64(i)*math.Pi/12
-					px := b.x + b.radius + b.radius*math.Cos(a)
-					py := b.y + b.radius - b.radius*math.Sin(a)
-					if barrier.bounds[0].IsLeft(px, py) <= 0 &&
-						barrier.bounds[1].IsLeft(px, py) <= 0 &&
-						barrier.bounds[2].IsLeft(px, py) <= 0 {
-
-						nx := math.Cos(math.Pi / 4.0)
-						ny := -math.Sin(math.Pi / 4.0)
-
-						px := b.x + b.radius + b.radius*math.Cos(3.926991)
-						py := b.y + b.radius - b.radius*math.Sin(3.926991)
-						bbx, bby := barrier.bounds[0].x0, barrier.bounds[0].y0
-						nOffset := rl.Vector2DotProduct(rl.Vector2{X: float32(nx), Y: float32(ny)}, rl.Vector2{X: float32(bbx), Y: float32(bby)})
-						dist := rl.Vector2DotProduct(rl.Vector2{X: float32(nx), Y: float32(ny)}, rl.Vector2{X: float32(px), Y: float32(py)})
-						dist -= nOffset
-						r := reflect(vec2f{b.vx, b.vy}, vec2f{nx, ny})
-						r = scale(r, 0.6)
-						b.vx, b.vy = r.x, r.y
-						b.x += float64(-dist-1) * math.Cos(nx)
-						b.y -= float64(-dist-1) * -math.Sin(ny)
-						break
-					}
-				}
-			} else if dx < 0 {
-				for i := 0; i <= 6; i++ {
-					// 5.497787
-					a := 3*math.Pi/2 + float64(i)*math.Pi/12
-					px := b.x + b.radius + b.radius*math.Cos(a)
-					py := b.y + b.radius - b.radius*math.Sin(a)
-					if barrier.bounds[0].IsLeft(px, py) <= 0 &&
-						barrier.bounds[1].IsLeft(px, py) <= 0 &&
-						barrier.bounds[2].IsLeft(px, py) <= 0 {
-
-						nx := math.Cos(3 * math.Pi / 4.0)
-						ny := -math.Sin(3 * math.Pi / 4.0)
-
-						bbx, bby := barrier.bounds[1].x0, barrier.bounds[1].y0
-						px = b.x + b.radius + b.radius*math.Cos(5.497787)
-						py = b.y + b.radius - b.radius*math.Sin(5.497787)
-						nOffset := rl.Vector2DotProduct(rl.Vector2{X: float32(nx), Y: float32(ny)}, rl.Vector2{X: float32(bbx), Y: float32(bby)})
-						dist := rl.Vector2DotProduct(rl.Vector2{X: float32(nx), Y: float32(ny)}, rl.Vector2{X: float32(px), Y: float32(py)})
-						dist -= nOffset
-
-						r := reflect(vec2f{b.vx, b.vy}, vec2f{nx, ny})
-						r = scale(r, 0.6)
-						b.vx, b.vy = r.x, r.y
-						b.x -= float64(-dist-1) * math.Cos(nx)
-						b.y -= float64(-dist-1) * -math.Sin(ny)
-						break
-					}
-				}
-			} else {
-				px := b.x + b.radius
-				py := b.y + 2*b.radius
-				if barrier.bounds[0].IsLeft(px, py) <= 0 &&
-					barrier.bounds[1].IsLeft(px, py) <= 0 &&
-					barrier.bounds[2].IsLeft(px, py) <= 0 {
-					b.vy *= -0.6
-					b.vx *= 0.6
-				}
-			}
+			t.SetPosition(queues[n].dropPosition.x, queues[n].dropPosition.y)
+			t.dropPoint = n
+			queues[n].push(t)
 		}
+	}
+	c.queues = queues
+	if c.currentDropPoint >= len(queues) {
+		c.currentDropPoint = len(queues) / 2
+	}
+	b.chaos = c.chaos
+	c.board = b
+}
 
-		// zone "collisions"
-		// all zones min y is 1225.0
-		if b.y > 1400 {
-			for _, z := range c.goalZones {
-				if b.x+b.radius >= z.x && b.x+b.radius < z.x+z.w {
-					c.rewardMultiplier = z.rewardValue
-					z.Hit()
-					break
-				}
-			}
+// changeBoard loads the board off the main loop since checking
+// it over can take a moment. It's swapped in once the tokens in
+// play have all landed.
+func (c *Core) changeBoard(name string) {
+	if c.loadingBoard {
+		return
+	}
+	c.loadingBoard = true
+	go func() {
+		b, err := loadBoard(name)
+		if err != nil {
+			log.Println("couldn't load plinko board", err.Error())
+			events.Emit(events.New("plinko", "", "board_invalid").
+				With("board", name).
+				With("error", err.Error()))
 		}
+		c.boardChannel <- b
+	}()
+}
 
-		if b.y > gameHeight+50 {
-			b.falling = false
-			reward := b.Value.Mul(b.Value, big.NewInt(int64(c.rewardMultiplier)))
-			if reward.Cmp(big.NewInt(0)) == 1 {
-				sound.Play("gold")
-			} else {
-				if rand.Intn(50) < 1 && b.tokenType == typeNormal {
-					c.writeChannel <- fmt.Sprintf("plinko secondChance %s\n", b.playerName)
-					c.tokens = removeBall(c.tokens, idx)
-					c.DropBall(c.currentDropPoint, big.NewInt(1), b.playerName, "#FFFFFF", typeSecondChance)
-					return
-				}
-			}
-			c.writeChannel <- fmt.Sprintf("plinko result %s %d\n", b.playerName, reward)
-			c.tokens = removeBall(c.tokens, idx)
-		}
+func (c *Core) CheckForCollision(delta float64) {
+	var landed []*token
+	c.tokens, landed = c.board.step(c.tokens, delta)
+	for _, b := range landed {
+		c.payout(b)
 	}
 }
 
-func removeBall(s []*token, i int) []*token {
-	s[len(s)-1], s[i] = s[i], s[len(s)-1]
-	return s[:len(s)-1]
+// payout sends off the result for a token which has
+// fallen through to the bottom of the board
+func (c *Core) payout(b *token) {
+	multiplier := 0
+	if b.zone != nil {
+		multiplier = b.zone.rewardValue
+	}
+	reward := new(big.Int).Mul(b.Value, big.NewInt(int64(multiplier)))
+	recordDrop(c.board, b, reward)
+	r := c.board.newDropRecord(b)
+	r.Multiplier = multiplier
+	r.Payout = reward
+	outcome := "loss"
+	if reward.Cmp(big.NewInt(0)) == 1 {
+		outcome = "win"
+		sound.Play("gold")
+	} else if b.roll < 1 && b.tokenType == typeNormal {
+		r.SecondChance = true
+		logDrop(r)
+		events.Emit(events.New("plinko", b.playerName, "second_chance").With("dropID", b.dropID))
+		c.DropBall(c.currentDropPoint, big.NewInt(1), b.playerName, "#FFFFFF", typeSecondChance)
+		return
+	}
+	logDrop(r)
+	events.Emit(events.New("plinko", b.playerName, outcome).
+		WithPayout(reward).
+		With("multiplier", multiplier).
+		With("tokenType", b.tokenType).
+		With("board", c.board.name).
+		With("dropID", b.dropID))
 }
 
 func (c *Core) Update(d float64) {
+	if !c.running {
+		return
+	}
+	select {
+	case b := <-c.boardChannel:
+		c.loadingBoard = false
+		c.pendingBoard = b
+	default:
+	}
+	if c.pendingBoard != nil && len(c.tokens) == 0 {
+		c.setBoard(c.pendingBoard)
+		events.Emit(events.New("plinko", "", "board_changed").With("board", c.board.name))
+		c.pendingBoard = nil
+	}
+	// like board changes, chaos only comes and goes between drops
+	// so every drop can be replayed on the board it fell through
+	if len(c.tokens) == 0 {
+		c.board.chaos = c.chaos
+	}
+
 	select {
 	case <-timerChannel:
+		// held while a new board waits for the board to clear,
+		// they'll drop on the new one
+		if c.pendingBoard != nil {
+			break
+		}
 		for i := 0; i < len(c.queues); i++ {
 			t, err := c.queues[i].pop()
 			if err != nil {
@@ -361,22 +261,114 @@ func (c *Core) Update(d float64) {
 			}
 			c.tokens = append(c.tokens, t)
 			t.SetPosition(c.queues[i].dropPosition.x, c.queues[i].dropPosition.y)
-			t.Release()
+			c.board.release(t)
 		}
 	default:
 	}
 
 	delta := float64(time.Since(c.lastUpdate).Milliseconds())
+	c.CheckForCollision(delta)
+	for _, t := range c.tokens {
+		t.recordTrail()
+	}
+	c.lastUpdate = time.Now()
+	c.statsTime -= delta
+	updateStats(delta)
 
-	for _, b := range c.tokens {
-		b.Update(delta)
+	// once everything has landed we can get out of the way
+	if len(c.tokens) == 0 && c.queuedCount() == 0 && !c.loadingBoard && c.pendingBoard == nil && c.statsTime <= 0 {
+		c.running = false
+		flushStats()
 	}
-	c.CheckForCollision(delta)
+}
+
+func (c *Core) Start() {
 	c.lastUpdate = time.Now()
+	c.running = true
+}
+
+// Stop drops any tokens in play or queued without paying them out
+func (c *Core) Stop() {
+	c.running = false
+	c.statsTime = 0
+	flushStats()
+	cancelled := c.tokens
+	for i := range c.queues {
+		cancelled = append(cancelled, c.queues[i].Tokens...)
+		c.queues[i].Tokens = []*token{}
+	}
+	c.tokens = []*token{}
+	refund(cancelled)
+}
+
+func (c *Core) Active() bool {
+	return c.running
+}
+
+func (c *Core) Name() string {
+	return "plinko"
+}
+
+func (c *Core) Describe() string {
+	return fmt.Sprintf("%d tokens falling, %d queued", len(c.tokens), c.queuedCount())
+}
+
+func (c *Core) queuedCount() int {
+	n := 0
+	for _, q := range c.queues {
+		n += len(q.Tokens)
+	}
+	return n
 }
 
 func (c *Core) HandleMessage(args []string) {
-	// !plinko drop n username
+	// !plinko board name
+	// switch to a different board once the current drops are done
+	if args[0] == "board" {
+		if len(args) < 2 {
+			return
+		}
+		c.changeBoard(args[1])
+		return
+	}
+	// !plinko stats [reset]
+	// show how the zones and drop points have paid out
+	if args[0] == "stats" {
+		if len(args) >= 2 && args[1] == "reset" {
+			resetStats(c.board)
+		}
+		c.statsTime = statsShowTime
+		return
+	}
+	// !plinko chaos [on|off]
+	// bring out the chaos obstacles, toggling without on or off
+	if args[0] == "chaos" {
+		c.chaos = !c.chaos
+		if len(args) >= 2 {
+			c.chaos = args[1] == "on"
+		}
+		outcome := "chaos_off"
+		if c.chaos {
+			outcome = "chaos_on"
+		}
+		events.Emit(events.New("plinko", "", outcome).With("board", c.board.name))
+		return
+	}
+	// !plinko verify dropID
+	// replay a drop from the results log to check it
+	if args[0] == "verify" {
+		if len(args) >= 2 {
+			verify(args[1])
+		}
+		return
+	}
+	// !plinko queue [username]
+	// !plinko cancel username
+	if args[0] == "queue" || args[0] == "cancel" {
+		c.handleQueueMessage(args)
+		return
+	}
+	// !plinko drop n username [color] [value] [avatarURL]
 	// drop a token at drop position n for the given username
 	if args[0] == "drop" {
 		color := "#0000FF"
@@ -403,42 +395,92 @@ func (c *Core) HandleMessage(args []string) {
 				return
 			}
 		}
+		if len(args) >= 6 {
+			requestAvatar(args[2], args[5])
+		}
 		c.DropBall(n, value, args[2], color, typeNormal)
 	}
 }
 
 func (c *Core) Draw() {
+	if c.statsTime > 0 {
+		drawStats(c.board, statsShowTime-c.statsTime)
+	}
+	c.drawQueues()
 	if len(c.tokens) == 0 {
 		return
 	}
 	for _, v := range c.tokens {
-		v.Draw()
+		v.DrawTrail()
 	}
-	for _, v := range c.pegs {
-		v.Draw()
+	// switching shaders flushes the draw batch, so draw all the
+	// tokens of each type together rather than swapping per token
+	for _, tokenType := range []int{typeNormal, typeSuper, typeSecondChance} {
+		shaderSet := false
+		for _, v := range c.tokens {
+			if v.tokenType != tokenType || !v.falling {
+				continue
+			}
+			if !shaderSet && tokenType != typeNormal {
+				rl.BeginShaderMode(v.shader)
+				shaderSet = true
+			}
+			v.Draw()
+		}
+		if shaderSet {
+			rl.EndShaderMode()
+		}
 	}
-	for _, v := range c.barriers {
+	drawLabels(c.board.hash, c.tokens)
+	for _, v := range c.board.pegs {
 		v.Draw()
 	}
-	for _, v := range c.goalZones {
+	c.board.drawObstacles()
+	for _, v := range c.board.barriers {
 		v.Draw()
 	}
-	for k, v := range c.queues {
-		rl.DrawText(fmt.Sprint(k), int32(v.dropPosition.x), int32(v.dropPosition.y)+35, 72, rl.Green)
+	for _, v := range c.board.zones {
+		v.Draw()
 	}
 }
 
-func (c *Core) DropBall(pos int, value *big.Int, playerName, playerColor string, tokenType int) {
+// DropBall queues up a token at the drop point for the player and
+// lets the bot know where they are in line
+func (c *Core) DropBall(pos int, value *big.Int, playerName, playerColor string, tokenType int) error {
 	// make a new token with its pos set to the selected drop point
 	if pos < 0 || pos >= len(c.queues) {
-		return // do nothing for now, but should return an error
-		// or is this validated on the other end? no
+		return fmt.Errorf("no drop point %d", pos)
+	}
+	// second chances were already paid for so they skip the limits
+	if tokenType != typeSecondChance {
+		reason := queueLimit(c.queues, pos, playerName)
+		if c.pendingBoard != nil {
+			reason = "board_changing"
+		}
+		if reason != "" {
+			events.Emit(events.New("plinko", playerName, "queue_rejected").
+				WithPayout(value).
+				With("dropPoint", pos).
+				With("reason", reason))
+			return errors.New(reason)
+		}
 	}
 	if value.Cmp(big.NewInt(1)) == 1 {
 		tokenType = typeSuper
 	}
 	t := NewToken(playerName, playerColor, tokenImg, c.queues[pos].dropPosition, value, tokenType)
+	t.dropPoint = pos
+	t.seed = newSeed()
+	t.dropID = dropID(t.seed)
 	c.queues[pos].push(t)
+	// one token leaves each queue a second
+	position := len(c.queues[pos].Tokens)
+	events.Emit(events.New("plinko", playerName, "queued").
+		With("dropPoint", pos).
+		With("position", position).
+		With("wait", position).
+		With("dropID", t.dropID))
+	return nil
 }
 
 func (c *Core) DropAll(playerName, playerColor string) {
@@ -487,60 +529,7 @@ func generateBounds(screenWidth, screenHeight float64) []*box {
 	return boxes
 }
 
-func generatePegs(screenWidth, screenHeight float64) []*peg {
-	pegImg := rl.LoadTexture("./images/plinko/token.png")
-	pegs := make([]*peg, numColumns*numRows)
-	halfImgWidth := float64(pegImg.Width) / 2.0
-	offset := 25.0
-	for i := 0; i < len(pegs); i++ {
-		if i%numColumns == 0 {
-			offset *= -1
-		}
-		x := (float64((i%numColumns)-numColumns/2)*100.0 + (screenWidth/2 - halfImgWidth)) + offset
-		y := float64(i/numColumns)*75.0 + 200.0
-		radius := float64(pegImg.Width) / 2.0
-		p := peg{
-			x:      x,
-			y:      y,
-			radius: radius,
-			img:    pegImg,
-		}
-		pegs[i] = &p
-	}
-	return pegs
-}
-
-func generateGoalZones() []*zone {
-	zoneCount := 11
-	zones := make([]*zone, zoneCount)
-	for i := 0; i < zoneCount; i++ {
-		w := gameWidth / float64(zoneCount)
-		min := fPoint{
-			x: float64(i) * w,
-			y: gameHeight,
-		}
-		max := fPoint{
-			x: min.x + w,
-			y: gameHeight + 10,
-		}
-		z := NewZone(fRect{min, max}, goalValues[i])
-		zones[i] = z
-	}
-	return zones
-}
-
-func generateBarriers(n int) []*barrier {
-	barriers := []*barrier{}
-
-	for i := 0; i < n; i++ {
-		b := NewBarrier(barrierImg)
-		b.SetPosition(float64(i)*gameWidth/float64(n-1), gameHeight-b.h/2)
-		barriers = append(barriers, b)
-	}
-
-	return barriers
-}
-
 func (c *Core) Cleanup() {
 	c.CancelTimer()
+	flushStats()
 }
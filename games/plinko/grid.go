@@ -0,0 +1,140 @@
+package plinko
+
+import (
+	"math"
+
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+// cellSize needs to be at least as big as the furthest apart two
+// things can be and still touch, so only the neighbouring cells
+// ever need to be checked
+const cellSize = 64.0
+
+// spatialHash buckets things by where their centers are on a
+// uniform grid. Anything off the edges goes in the edge cells.
+type spatialHash struct {
+	columns int
+	rows    int
+	pegs    [][]*peg
+	tokens  [][]*token
+	labels  [][]rl.Rectangle // in every cell they cover, being wider than one
+}
+
+func newSpatialHash(width, height float64) *spatialHash {
+	columns := int(math.Ceil(width / cellSize))
+	rows := int(math.Ceil(height / cellSize))
+	return &spatialHash{
+		columns: columns,
+		rows:    rows,
+		pegs:    make([][]*peg, columns*rows),
+		tokens:  make([][]*token, columns*rows),
+		labels:  make([][]rl.Rectangle, columns*rows),
+	}
+}
+
+func (h *spatialHash) cell(x, y float64) (int, int) {
+	cx := int(math.Floor(x / cellSize))
+	cy := int(math.Floor(y / cellSize))
+	if cx < 0 {
+		cx = 0
+	} else if cx >= h.columns {
+		cx = h.columns - 1
+	}
+	if cy < 0 {
+		cy = 0
+	} else if cy >= h.rows {
+		cy = h.rows - 1
+	}
+	return cx, cy
+}
+
+func (h *spatialHash) insertPeg(p *peg) {
+	cx, cy := h.cell(p.x+p.radius, p.y+p.radius)
+	h.pegs[cy*h.columns+cx] = append(h.pegs[cy*h.columns+cx], p)
+}
+
+// setTokens clears out the tokens from the last frame and
+// buckets the current ones
+func (h *spatialHash) setTokens(tokens []*token) {
+	for i := range h.tokens {
+		h.tokens[i] = h.tokens[i][:0]
+	}
+	for _, t := range tokens {
+		cx, cy := h.cell(t.x+t.radius, t.y+t.radius)
+		h.tokens[cy*h.columns+cx] = append(h.tokens[cy*h.columns+cx], t)
+	}
+}
+
+// nearbyPegs calls f for each peg in the cells around x, y
+func (h *spatialHash) nearbyPegs(x, y float64, f func(*peg)) {
+	cx, cy := h.cell(x, y)
+	for j := cy - 1; j <= cy+1; j++ {
+		if j < 0 || j >= h.rows {
+			continue
+		}
+		for i := cx - 1; i <= cx+1; i++ {
+			if i < 0 || i >= h.columns {
+				continue
+			}
+			for _, p := range h.pegs[j*h.columns+i] {
+				f(p)
+			}
+		}
+	}
+}
+
+// nearbyTokens calls f for each token in the cells around x, y
+func (h *spatialHash) nearbyTokens(x, y float64, f func(*token)) {
+	cx, cy := h.cell(x, y)
+	for j := cy - 1; j <= cy+1; j++ {
+		if j < 0 || j >= h.rows {
+			continue
+		}
+		for i := cx - 1; i <= cx+1; i++ {
+			if i < 0 || i >= h.columns {
+				continue
+			}
+			for _, t := range h.tokens[j*h.columns+i] {
+				f(t)
+			}
+		}
+	}
+}
+
+// clearLabels forgets the labels placed last frame
+func (h *spatialHash) clearLabels() {
+	for i := range h.labels {
+		h.labels[i] = h.labels[i][:0]
+	}
+}
+
+// labelFits is whether r is clear of every label placed so far
+func (h *spatialHash) labelFits(r rl.Rectangle) bool {
+	fits := true
+	h.labelCells(r, func(i int) {
+		for _, l := range h.labels[i] {
+			if fits && rl.CheckCollisionRecs(r, l) {
+				fits = false
+			}
+		}
+	})
+	return fits
+}
+
+func (h *spatialHash) insertLabel(r rl.Rectangle) {
+	h.labelCells(r, func(i int) {
+		h.labels[i] = append(h.labels[i], r)
+	})
+}
+
+// labelCells calls f for each cell r covers
+func (h *spatialHash) labelCells(r rl.Rectangle, f func(int)) {
+	x0, y0 := h.cell(float64(r.X), float64(r.Y))
+	x1, y1 := h.cell(float64(r.X+r.Width), float64(r.Y+r.Height))
+	for j := y0; j <= y1; j++ {
+		for i := x0; i <= x1; i++ {
+			f(j*h.columns + i)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package plinko
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	bumperLitTime = 150.0 // ms
+	spinnerWidth  = 10.0
+	gateHeight    = 24.0
+)
+
+var (
+	bumperMaterial  = material{restitution: 0.9, friction: 0.1}
+	spinnerMaterial = material{restitution: 0.6, friction: 0.2}
+)
+
+// Anything marked chaos is only there during chaos rounds
+
+type bumperDef struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Radius float64 `json:"radius"`
+	Kick   float64 `json:"kick"` // speed added on every hit
+	Chaos  bool    `json:"chaos,omitempty"`
+}
+
+type spinnerDef struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Length float64 `json:"length"`
+	Speed  float64 `json:"speed"` // radians per second, clockwise
+	Chaos  bool    `json:"chaos,omitempty"`
+}
+
+// movingRowDef sets a row of the peg grid sliding side to side
+type movingRowDef struct {
+	Row       int     `json:"row"`
+	Amplitude float64 `json:"amplitude"`
+	Period    float64 `json:"period"` // seconds
+	Chaos     bool    `json:"chaos,omitempty"`
+}
+
+type gateDef struct {
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Width      float64 `json:"width"`
+	Multiplier int     `json:"multiplier"`
+	Chaos      bool    `json:"chaos,omitempty"`
+}
+
+type bumper struct {
+	x      float64
+	y      float64
+	radius float64
+	kick   float64
+	chaos  bool
+	lit    float64 // ms left lit up after a hit
+}
+
+type spinner struct {
+	x      float64
+	y      float64
+	length float64
+	speed  float64
+	angle  float64
+	chaos  bool
+}
+
+type gate struct {
+	x          float64
+	y          float64
+	w          float64
+	multiplier int
+	chaos      bool
+	lit        float64
+}
+
+// active reports whether something is on the board right now
+func (bd *board) active(chaos bool) bool {
+	return !chaos || bd.chaos
+}
+
+// hasChaos is whether anything on the board only comes out in
+// chaos rounds
+func (bd *board) hasChaos() bool {
+	for _, p := range bd.movingPegs {
+		if p.chaos {
+			return true
+		}
+	}
+	for _, bp := range bd.bumpers {
+		if bp.chaos {
+			return true
+		}
+	}
+	for _, s := range bd.spinners {
+		if s.chaos {
+			return true
+		}
+	}
+	for _, g := range bd.gates {
+		if g.chaos {
+			return true
+		}
+	}
+	return false
+}
+
+// updateObstacles moves everything along to the board time
+func (bd *board) updateObstacles(dt float64) {
+	bd.time += dt
+	t := bd.time / 1000
+	for _, p := range bd.movingPegs {
+		p.vx = 0
+		x := p.baseX
+		if bd.active(p.chaos) {
+			w := 2 * math.Pi / p.period
+			x += p.amplitude * math.Sin(w*t)
+			p.vx = p.amplitude * w * math.Cos(w*t)
+		}
+		p.x = x - p.radius
+	}
+	for _, s := range bd.spinners {
+		s.angle = s.speed * t
+	}
+	for _, bp := range bd.bumpers {
+		bp.lit = math.Max(0, bp.lit-dt)
+	}
+	for _, g := range bd.gates {
+		g.lit = math.Max(0, g.lit-dt)
+	}
+}
+
+// collideObstacles checks the token against everything on the
+// board which isn't in the spatial hash
+func (bd *board) collideObstacles(b *token) {
+	for _, p := range bd.movingPegs {
+		b.collideMovingPeg(p)
+	}
+	for _, bp := range bd.bumpers {
+		if bd.active(bp.chaos) {
+			b.collideBumper(bp)
+		}
+	}
+	for _, s := range bd.spinners {
+		if bd.active(s.chaos) {
+			b.collideSpinner(s)
+		}
+	}
+	for _, g := range bd.gates {
+		if bd.active(g.chaos) {
+			b.passGate(g)
+		}
+	}
+}
+
+func (b *token) collideMovingPeg(p *peg) {
+	d := sub(b.center(), vec2f{p.x + p.radius, p.y + p.radius})
+	dist := mag(d)
+	if dist >= b.radius+p.radius || dist == 0 {
+		return
+	}
+	b.resolveMoving(scale(d, 1/dist), b.radius+p.radius-dist, pegMaterial, vec2f{p.vx, 0})
+}
+
+func (b *token) collideBumper(bp *bumper) {
+	d := sub(b.center(), vec2f{bp.x, bp.y})
+	dist := mag(d)
+	if dist >= b.radius+bp.radius || dist == 0 {
+		return
+	}
+	n := scale(d, 1/dist)
+	b.resolveStatic(n, b.radius+bp.radius-dist, bumperMaterial)
+	b.vx += n.x * bp.kick
+	b.vy += n.y * bp.kick
+	bp.lit = bumperLitTime
+}
+
+func (b *token) collideSpinner(s *spinner) {
+	c := b.center()
+	if math.Abs(c.x-s.x) > s.length+b.radius || math.Abs(c.y-s.y) > s.length+b.radius {
+		return
+	}
+	arm := vec2f{math.Cos(s.angle) * s.length, math.Sin(s.angle) * s.length}
+	e := edge{s.x - arm.x, s.y - arm.y, s.x + arm.x, s.y + arm.y}
+	closest := closestOnEdge(c, e)
+	d := sub(c, closest)
+	dist := mag(d)
+	if dist >= b.radius+spinnerWidth/2 || dist == 0 {
+		return
+	}
+	// the bar is moving faster the further out it's hit
+	r := sub(closest, vec2f{s.x, s.y})
+	v := vec2f{-s.speed * r.y, s.speed * r.x}
+	b.resolveMoving(scale(d, 1/dist), b.radius+spinnerWidth/2-dist, spinnerMaterial, v)
+}
+
+// passGate multiplies the tokens value the first time it falls
+// through the gate
+func (b *token) passGate(g *gate) {
+	c := b.center()
+	if c.x < g.x-g.w/2 || c.x > g.x+g.w/2 || c.y < g.y-gateHeight/2 || c.y > g.y+gateHeight/2 {
+		return
+	}
+	for _, passed := range b.gates {
+		if passed == g {
+			return
+		}
+	}
+	b.gates = append(b.gates, g)
+	b.Value = new(big.Int).Mul(b.Value, big.NewInt(int64(g.multiplier)))
+	g.lit = bumperLitTime
+}
+
+// resolveMoving is resolveStatic for a surface moving at v,
+// done by looking at the collision from the surface's point of view
+func (b *token) resolveMoving(n vec2f, depth float64, m material, v vec2f) {
+	b.vx, b.vy = b.vx-v.x, b.vy-v.y
+	b.resolveStatic(n, depth, m)
+	b.vx, b.vy = b.vx+v.x, b.vy+v.y
+}
+
+func (bd *board) drawObstacles() {
+	for _, p := range bd.movingPegs {
+		p.Draw()
+	}
+	for _, bp := range bd.bumpers {
+		if !bd.active(bp.chaos) {
+			continue
+		}
+		c := rl.Color{R: 0xFF, G: 0x40, B: 0xA0, A: 0xFF}
+		if bp.lit > 0 {
+			c = rl.White
+		}
+		rl.DrawCircle(int32(bp.x), int32(bp.y), float32(bp.radius), c)
+		rl.DrawCircle(int32(bp.x), int32(bp.y), float32(bp.radius)*0.6, rl.Color{R: 0x80, G: 0x00, B: 0x50, A: 0xFF})
+	}
+	for _, s := range bd.spinners {
+		if !bd.active(s.chaos) {
+			continue
+		}
+		arm := rl.Vector2{X: float32(math.Cos(s.angle) * s.length), Y: float32(math.Sin(s.angle) * s.length)}
+		center := rl.Vector2{X: float32(s.x), Y: float32(s.y)}
+		rl.DrawLineEx(rl.Vector2Subtract(center, arm), rl.Vector2Add(center, arm), spinnerWidth, rl.Orange)
+		rl.DrawCircleV(center, spinnerWidth, rl.Gold)
+	}
+	for _, g := range bd.gates {
+		if !bd.active(g.chaos) {
+			continue
+		}
+		a := uint8(0x66)
+		if g.lit > 0 {
+			a = 0xDD
+		}
+		rl.DrawRectangle(int32(g.x-g.w/2), int32(g.y-gateHeight/2), int32(g.w), gateHeight, rl.Color{R: 0x00, G: 0xFF, B: 0x80, A: a})
+		rl.DrawText(fmt.Sprintf("x%d", g.multiplier), int32(g.x)-20, int32(g.y-gateHeight/2)-36, 32, rl.Green)
+	}
+}
@@ -9,6 +9,13 @@ type peg struct {
 	y      float64
 	radius float64
 	img    rl.Texture2D
+
+	// for pegs in a moving row
+	baseX     float64 // center
+	amplitude float64
+	period    float64 // seconds
+	vx        float64
+	chaos     bool
 }
 
 func (p *peg) Draw() {
@@ -0,0 +1,277 @@
+package plinko
+
+import (
+	"math"
+)
+
+const (
+	// small enough that the fastest token only moves a fraction of
+	// a peg per substep so nothing can tunnel through
+	substepTime = 4.0 // ms
+	// a long frame (window dragged, etc.) is simulated as this much
+	// rather than firing everything through the board at once
+	maxStepTime = 50.0 // ms
+	zoneLine    = 1400.0
+)
+
+// material is how a surface responds to a token hitting it.
+// restitution is how much of the speed into the surface is
+// kept and friction is the coefficient along it.
+type material struct {
+	restitution float64
+	friction    float64
+}
+
+var (
+	pegMaterial     = material{restitution: 0.6, friction: 0.15}
+	wallMaterial    = material{restitution: 0.6, friction: 0.1}
+	barrierMaterial = material{restitution: 0.5, friction: 0.3}
+	tokenMaterial   = material{restitution: 0.85, friction: 0.1}
+)
+
+// step advances the falling tokens by delta ms in fixed substeps,
+// resolving collisions with the board and each other. Any time
+// left over is carried to the next step so every token sees the
+// same substeps however the frames fall, which is what lets a
+// drop be replayed. Tokens which have dropped out of the bottom
+// of the board are split out from those still in play.
+func (bd *board) step(tokens []*token, delta float64) (inPlay, landed []*token) {
+	bd.accumulator += math.Min(delta, maxStepTime)
+	for bd.accumulator >= substepTime {
+		bd.substep(tokens, substepTime)
+		bd.accumulator -= substepTime
+	}
+
+	for _, b := range tokens {
+		if !b.falling {
+			landed = append(landed, b)
+			continue
+		}
+		inPlay = append(inPlay, b)
+	}
+	return inPlay, landed
+}
+
+func (bd *board) substep(tokens []*token, dt float64) {
+	bd.updateObstacles(dt)
+	for _, b := range tokens {
+		b.Update(dt)
+	}
+	bd.hash.setTokens(tokens)
+	for _, b := range tokens {
+		if !b.falling {
+			continue
+		}
+		c := b.center()
+		bd.hash.nearbyPegs(c.x, c.y, func(p *peg) {
+			b.collidePeg(p)
+		})
+		bd.collideObstacles(b)
+		bd.hash.nearbyTokens(c.x, c.y, func(ot *token) {
+			if ot != b && ot.falling {
+				collideTokens(b, ot)
+			}
+		})
+		b.collideWalls()
+		for _, br := range bd.barriers {
+			b.collideBarrier(br)
+		}
+
+		// zone "collisions"
+		if b.y > zoneLine {
+			bd.landIn(b)
+		}
+	}
+	for _, b := range tokens {
+		if b.falling {
+			b.recordPath(bd.time)
+			if b.y > gameHeight+50 {
+				b.falling = false
+			}
+		}
+	}
+}
+
+// landIn puts the token in the zone it's over
+func (bd *board) landIn(b *token) {
+	c := b.center()
+	for _, z := range bd.zones {
+		if c.x >= z.x && c.x < z.x+z.w {
+			b.zone = z
+			return
+		}
+	}
+}
+
+func (b *token) collidePeg(p *peg) {
+	d := sub(b.center(), vec2f{p.x + p.radius, p.y + p.radius})
+	dist := mag(d)
+	if dist >= b.radius+p.radius || dist == 0 {
+		return
+	}
+	b.resolveStatic(scale(d, 1/dist), b.radius+p.radius-dist, pegMaterial)
+}
+
+func (b *token) collideWalls() {
+	c := b.center()
+	if c.x-b.radius < 0 {
+		b.resolveStatic(vec2f{1, 0}, b.radius-c.x, wallMaterial)
+	}
+	if c.x+b.radius > gameWidth {
+		b.resolveStatic(vec2f{-1, 0}, c.x+b.radius-gameWidth, wallMaterial)
+	}
+}
+
+func (b *token) collideBarrier(br *barrier) {
+	c := b.center()
+	if c.y+b.radius < br.y-br.h/2 || math.Abs(c.x-br.x) > br.w/2+b.radius {
+		return
+	}
+	inside := true
+	closest, dist := vec2f{}, math.Inf(1)
+	for _, e := range br.bounds {
+		if e.IsLeft(c.x, c.y) > 0 {
+			inside = false
+		}
+		p := closestOnEdge(c, e)
+		if d := mag(sub(c, p)); d < dist {
+			closest, dist = p, d
+		}
+	}
+	if dist == 0 {
+		return
+	}
+	if inside {
+		// the center has gone right in, so push out the nearest side
+		b.resolveStatic(scale(sub(closest, c), 1/dist), b.radius+dist, barrierMaterial)
+	} else if dist < b.radius {
+		b.resolveStatic(scale(sub(c, closest), 1/dist), b.radius-dist, barrierMaterial)
+	}
+}
+
+func closestOnEdge(p vec2f, e edge) vec2f {
+	a := vec2f{e.x0, e.y0}
+	ab := sub(vec2f{e.x1, e.y1}, a)
+	t := dot(sub(p, a), ab) / dot(ab, ab)
+	t = math.Max(0, math.Min(1, t))
+	return add(a, scale(ab, t))
+}
+
+func collideTokens(a, o *token) {
+	d := sub(a.center(), o.center())
+	dist := mag(d)
+	if dist >= a.radius+o.radius || dist == 0 {
+		return
+	}
+	n := scale(d, 1/dist)
+	// masses are equal so split the correction evenly, which
+	// also leaves the pair's height, and so energy, unchanged
+	depth := (a.radius + o.radius - dist) / 2
+	a.move(scale(n, depth))
+	o.move(scale(n, -depth))
+	contactImpulse(a, o, n, tokenMaterial)
+	// other tokens can't be replayed so this has to be checkpointed
+	a.touched, o.touched = true, true
+}
+
+// resolveStatic pushes the token depth out of something fixed
+// along n, which points out of the surface, and bounces it off
+func (b *token) resolveStatic(n vec2f, depth float64, m material) {
+	b.move(scale(n, depth))
+	b.payForLift(-n.y*depth, n)
+	contactImpulse(b, nil, n, m)
+}
+
+// payForLift takes the energy gained by pushing the token up
+// out of something back out of its motion, so the correction
+// can't add energy to the board. It comes out of what the
+// integration lost this substep first, then the speed into
+// the surface and only then anything else, so tokens can
+// still slide off things.
+func (b *token) payForLift(lift float64, n vec2f) {
+	if lift <= 0 {
+		return
+	}
+	// all per unit mass
+	cost := gravity*lift - b.slack
+	b.slack = math.Max(0, -cost)
+	if cost <= 0 {
+		return
+	}
+	if vn := dot(vec2f{b.vx, b.vy}, n); vn < 0 {
+		ke := 0.5 * vn * vn
+		left := math.Max(0, ke-cost)
+		dv := -math.Sqrt(2*left) - vn
+		b.vx, b.vy = b.vx+n.x*dv, b.vy+n.y*dv
+		cost -= ke - left
+	}
+	if cost <= 0 {
+		return
+	}
+	ke := 0.5 * (b.vx*b.vx + b.vy*b.vy)
+	if ke > 0 {
+		s := math.Sqrt(math.Max(0, ke-cost) / ke)
+		b.vx, b.vy = b.vx*s, b.vy*s
+	}
+	cost -= ke
+	spinKe := 0.25 * b.radius * b.radius * b.spin * b.spin
+	if cost > 0 && spinKe > 0 {
+		b.spin *= math.Sqrt(math.Max(0, spinKe-cost) / spinKe)
+	}
+}
+
+// contactImpulse applies the bounce and friction impulses between
+// token a and token o, or something fixed when o is nil. n is the
+// contact normal pointing towards a.
+func contactImpulse(a, o *token, n vec2f, m material) {
+	// from each center to the contact point
+	ra := scale(n, -a.radius)
+	rb := vec2f{}
+	invMass := 1 / a.mass
+	if o != nil {
+		rb = scale(n, o.radius)
+		invMass += 1 / o.mass
+	}
+	relative := func() vec2f {
+		v := a.pointVelocity(ra)
+		if o != nil {
+			v = sub(v, o.pointVelocity(rb))
+		}
+		return v
+	}
+
+	vn := dot(relative(), n)
+	if vn >= 0 {
+		// already separating
+		return
+	}
+	// contacts between circles are always in line with the
+	// centers so the normal impulse has no effect on spin
+	jn := -(1 + m.restitution) * vn / invMass
+	a.applyImpulse(scale(n, jn), ra)
+	if o != nil {
+		o.applyImpulse(scale(n, -jn), rb)
+	}
+
+	v := relative()
+	t := sub(v, scale(n, dot(v, n)))
+	vt := mag(t)
+	if vt < 1e-9 {
+		return
+	}
+	t = scale(t, 1/vt)
+	k := invMass + math.Pow(cross(ra, t), 2)/a.inertia()
+	if o != nil {
+		k += math.Pow(cross(rb, t), 2) / o.inertia()
+	}
+	// friction can stop the sliding at most, never reverse it
+	jt := math.Min(vt/k, m.friction*jn)
+	a.applyImpulse(scale(t, -jt), ra)
+	if o != nil {
+		o.applyImpulse(scale(t, jt), rb)
+	}
+}
+
+func cross(a, b vec2f) float64 {
+	return a.x*b.y - a.y*b.x
+}
@@ -0,0 +1,239 @@
+package plinko
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+func testBoard(tb testing.TB) *board {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b, err := def.build()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// spawnTokens scatters n falling tokens over the top half of the board
+func spawnTokens(rng *rand.Rand, n int) []*token {
+	tokens := make([]*token, n)
+	for i := range tokens {
+		tokens[i] = &token{
+			x:       rng.Float64() * (gameWidth - 2*tokenRadius),
+			y:       rng.Float64() * gameHeight / 2,
+			vx:      (rng.Float64() - 0.5) * 200,
+			vy:      rng.Float64() * 200,
+			radius:  tokenRadius,
+			mass:    tokenMass,
+			falling: true,
+			Value:   big.NewInt(1),
+		}
+	}
+	return tokens
+}
+
+func totalEnergy(tokens []*token) float64 {
+	e := 0.0
+	for _, t := range tokens {
+		e += t.energy()
+	}
+	return e
+}
+
+func TestEnergyNeverIncreases(t *testing.T) {
+	bd := testBoard(t)
+	rng := rand.New(rand.NewSource(1))
+	all := spawnTokens(rng, 200)
+	for _, tk := range all {
+		tk.spin = (rng.Float64() - 0.5) * 20
+	}
+	tokens := all
+	for frame := 0; frame < 3000 && len(tokens) > 0; frame++ {
+		before := totalEnergy(all)
+		tokens, _ = bd.step(tokens, 16)
+		after := totalEnergy(all)
+		// allow for floating point error only
+		if after > before+1e-9*math.Abs(before) {
+			t.Fatalf("energy went up from %f to %f on frame %d", before, after, frame)
+		}
+	}
+	if len(tokens) > 0 {
+		t.Errorf("%d tokens never landed", len(tokens))
+	}
+}
+
+// a single peg in the middle of an otherwise empty board
+func pegBoard(t *testing.T) *board {
+	def := boardDef{
+		Pegs:       []point{{X: gameWidth / 2, Y: 700}},
+		Zones:      []zoneDef{{Width: 1, Multiplier: 1}},
+		Barriers:   []float64{},
+		DropPoints: []point{{X: gameWidth / 2, Y: 38}},
+	}
+	b, err := def.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFastTokenDoesNotTunnel(t *testing.T) {
+	bd := pegBoard(t)
+	tk := &token{
+		x:       gameWidth/2 - tokenRadius,
+		y:       600 - tokenRadius,
+		vy:      3000,
+		radius:  tokenRadius,
+		mass:    tokenMass,
+		falling: true,
+	}
+	bd.step([]*token{tk}, maxStepTime)
+	if tk.center().y > 700 {
+		t.Fatalf("token passed through the peg to y %f", tk.center().y)
+	}
+	if tk.vy >= 0 {
+		t.Errorf("token didn't bounce, vy %f", tk.vy)
+	}
+}
+
+func TestRestitutionAndSpin(t *testing.T) {
+	// straight down onto the top of the peg
+	bd := pegBoard(t)
+	tk := &token{
+		x:       gameWidth/2 - tokenRadius,
+		y:       700 - pegRadius - 2*tokenRadius - 1,
+		vy:      400,
+		radius:  tokenRadius,
+		mass:    tokenMass,
+		falling: true,
+	}
+	bd.step([]*token{tk}, substepTime)
+	want := -pegMaterial.restitution * 400
+	if math.Abs(tk.vy-want) > 0.1*400 {
+		t.Errorf("bounced off at %f, want about %f", tk.vy, want)
+	}
+	if tk.spin != 0 {
+		t.Errorf("head on hit picked up spin %f", tk.spin)
+	}
+
+	// a glancing hit on the right of the peg should set it spinning
+	tk = &token{
+		x:       gameWidth/2 + 10 - tokenRadius,
+		y:       700 - pegRadius - 2*tokenRadius,
+		vy:      400,
+		radius:  tokenRadius,
+		mass:    tokenMass,
+		falling: true,
+	}
+	bd.step([]*token{tk}, substepTime)
+	if tk.spin == 0 {
+		t.Error("glancing hit didn't spin the token")
+	}
+	if tk.vx <= 0 {
+		t.Errorf("token should have been knocked right, vx %f", tk.vx)
+	}
+}
+
+func TestChaosRound(t *testing.T) {
+	bd := testBoard(t)
+	bd.chaos = true
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		n := i % len(bd.dropPoints)
+		dp := bd.dropPoints[n]
+		tk := &token{
+			x:       dp.x,
+			y:       dp.y,
+			vx:      releaseVelocity(rng.Float64()),
+			radius:  tokenRadius,
+			mass:    tokenMass,
+			falling: true,
+			Value:   big.NewInt(1),
+		}
+		if bd.simulate(tk) < 0 {
+			t.Fatalf("token %d never landed", i)
+		}
+		// the middle drop point is right over the gate
+		if n == 2 && tk.Value.Cmp(big.NewInt(2)) != 0 {
+			t.Errorf("token %d dropped over the gate is worth %s", i, tk.Value)
+		}
+	}
+}
+
+func benchmarkStep(b *testing.B, n int) {
+	bd := testBoard(b)
+	rng := rand.New(rand.NewSource(1))
+	tokens := spawnTokens(rng, n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var landed []*token
+		tokens, landed = bd.step(tokens, 16)
+		// keep the number of tokens in play steady
+		tokens = append(tokens, spawnTokens(rng, len(landed))...)
+	}
+}
+
+func BenchmarkStep50(b *testing.B)   { benchmarkStep(b, 50) }
+func BenchmarkStep200(b *testing.B)  { benchmarkStep(b, 200) }
+func BenchmarkStep1000(b *testing.B) { benchmarkStep(b, 1000) }
+
+// a board is only good if it works in chaos rounds as well
+func TestValidateChaosLayout(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd, err := def.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bd.validate(); err != nil {
+		t.Fatal(err)
+	}
+	// a big bumper sat over the first zone, only in chaos rounds
+	x := gameWidth / float64(len(def.Zones)) / 2
+	def.Bumpers = append(def.Bumpers, bumperDef{X: x, Y: gameHeight - 150, Radius: 250, Kick: 400, Chaos: true})
+	if bd, err = def.build(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bd.validate(); err == nil {
+		t.Error("zone blocked in chaos rounds passed")
+	}
+	if bd.chaos {
+		t.Error("validating left chaos on")
+	}
+}
+
+func TestLabelsAcrossCells(t *testing.T) {
+	h := newSpatialHash(gameWidth, gameHeight)
+	// wider than a cell, so it has to block the cells it reaches into
+	h.insertLabel(rl.Rectangle{X: 10, Y: 10, Width: cellSize * 3, Height: 20})
+	if h.labelFits(rl.Rectangle{X: cellSize*3 - 10, Y: 15, Width: 30, Height: 20}) {
+		t.Error("label three cells over fits on top of the wide one")
+	}
+	if !h.labelFits(rl.Rectangle{X: 10, Y: 40, Width: 30, Height: 20}) {
+		t.Error("label below the wide one doesn't fit")
+	}
+	h.clearLabels()
+	if !h.labelFits(rl.Rectangle{X: 10, Y: 10, Width: 30, Height: 20}) {
+		t.Error("labels weren't cleared")
+	}
+}
+
+func TestGateMustMultiply(t *testing.T) {
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Gates[0].Multiplier = 0
+	if _, err := def.build(); err == nil {
+		t.Error("built a board with a gate which wipes out the drop")
+	}
+}
@@ -0,0 +1,190 @@
+package plinko
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	maxQueueLength  = 15
+	maxUserQueued   = 5 // across every queue
+	queueMiniRadius = 8.0
+	queueRowLength  = 5
+	queueLabelH     = 110.0 // the drop point number under each one
+)
+
+type tokenQueue struct {
+	Tokens       []*token
+	dropPosition fPoint
+}
+
+// push the token to the back of the queue
+func (tq *tokenQueue) push(t *token) {
+	tq.Tokens = append(tq.Tokens, t)
+}
+
+// pop the front element from the front of the queue
+func (tq *tokenQueue) pop() (*token, error) {
+	if len(tq.Tokens) == 0 {
+		return nil, errors.New("nothing in queue")
+	}
+	t := tq.Tokens[0]
+	if len(tq.Tokens) == 1 {
+		tq.Tokens = []*token{}
+	} else {
+		tq.Tokens = tq.Tokens[1:]
+	}
+	return t, nil
+}
+
+// remove takes all of the players tokens out of the queue
+func (tq *tokenQueue) remove(player string) []*token {
+	kept, removed := []*token{}, []*token{}
+	for _, t := range tq.Tokens {
+		if strings.EqualFold(t.playerName, player) {
+			removed = append(removed, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	tq.Tokens = kept
+	return removed
+}
+
+// queueLimit gets why the player can't queue another token at
+// drop point pos, or "" if they can
+func queueLimit(queues []tokenQueue, pos int, player string) string {
+	if len(queues[pos].Tokens) >= maxQueueLength {
+		return "queue_full"
+	}
+	if userQueued(queues, player) >= maxUserQueued {
+		return "user_limit"
+	}
+	return ""
+}
+
+func userQueued(queues []tokenQueue, player string) int {
+	n := 0
+	for _, q := range queues {
+		for _, t := range q.Tokens {
+			if strings.EqualFold(t.playerName, player) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// !plinko queue [username]
+// !plinko cancel username
+func (c *Core) handleQueueMessage(args []string) {
+	switch args[0] {
+	case "queue":
+		lengths := []string{}
+		for i, q := range c.queues {
+			lengths = append(lengths, fmt.Sprintf("%d:%d", i, len(q.Tokens)))
+		}
+		e := events.New("plinko", "", "queue").
+			Status().
+			With("total", c.queuedCount()).
+			With("queues", strings.Join(lengths, " "))
+		if len(args) >= 2 {
+			// where each of the players tokens are in line
+			positions := []string{}
+			for i, q := range c.queues {
+				for k, t := range q.Tokens {
+					if strings.EqualFold(t.playerName, args[1]) {
+						positions = append(positions, fmt.Sprintf("%d:%d", i, k+1))
+					}
+				}
+			}
+			e.Player = args[1]
+			e = e.With("positions", strings.Join(positions, " "))
+		}
+		events.Emit(e)
+	case "cancel":
+		if len(args) < 2 {
+			return
+		}
+		count, value := 0, big.NewInt(0)
+		for i := range c.queues {
+			for _, t := range c.queues[i].remove(args[1]) {
+				count++
+				value.Add(value, t.Value)
+			}
+		}
+		// the value is there so the bot can refund it
+		events.Emit(events.New("plinko", args[1], "cancelled").
+			WithPayout(value).
+			With("count", count))
+	}
+}
+
+// refund emits a cancelled event for each player with tokens in
+// the list, carrying back what they were worth before any gates
+func refund(tokens []*token) {
+	players := []string{}
+	count := map[string]int{}
+	value := map[string]*big.Int{}
+	for _, t := range tokens {
+		key := strings.ToLower(t.playerName)
+		if _, ok := value[key]; !ok {
+			players = append(players, t.playerName)
+			value[key] = big.NewInt(0)
+		}
+		count[key]++
+		if t.startValue != nil {
+			value[key].Add(value[key], t.startValue)
+		} else {
+			value[key].Add(value[key], t.Value)
+		}
+	}
+	for _, player := range players {
+		key := strings.ToLower(player)
+		events.Emit(events.New("plinko", player, "cancelled").
+			WithPayout(value[key]).
+			With("count", count[key]).
+			With("reason", "stopped"))
+	}
+}
+
+// drawQueues shows the next token waiting at each drop point
+// with the rest of the line stacked up beside it
+func (c *Core) drawQueues() {
+	for k, q := range c.queues {
+		dp := q.dropPosition
+		rl.DrawText(fmt.Sprint(k), int32(dp.x), int32(dp.y)+35, 72, rl.Green)
+		if len(q.Tokens) == 0 {
+			continue
+		}
+		next := q.Tokens[0]
+		rl.DrawTexture(next.img, int32(dp.x), int32(dp.y), rl.Fade(next.playerColor, 0.6))
+
+		// stacked up above the drop point if the whole line fits
+		// there, otherwise hanging down over the top of the board
+		// under the drop point's number
+		rowH := 2*queueMiniRadius + 2
+		rows := int(math.Ceil(float64(maxQueueLength-1) / queueRowLength))
+		shown := int(math.Min(float64(len(q.Tokens)-1), float64(rows*queueRowLength)))
+		top, dir := dp.y-queueMiniRadius-1, -1.0
+		if float64(rows)*rowH > dp.y {
+			top, dir = dp.y+queueLabelH+queueMiniRadius, 1.0
+		}
+		cx := dp.x + tokenRadius
+		for i := 0; i < shown; i++ {
+			row, col := i/queueRowLength, i%queueRowLength
+			x := cx + (float64(col)-float64(queueRowLength-1)/2)*rowH
+			y := top + dir*float64(row)*rowH
+			rl.DrawCircle(int32(x), int32(y), queueMiniRadius, q.Tokens[i+1].playerColor)
+		}
+		if more := len(q.Tokens) - 1 - shown; more > 0 {
+			rl.DrawText(fmt.Sprintf("+%d", more), int32(cx+float64(queueRowLength)*rowH/2+4), int32(top-rowH/2), 24, rl.White)
+		}
+	}
+}
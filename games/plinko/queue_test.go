@@ -0,0 +1,93 @@
+package plinko
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+)
+
+// testCore gets a core on the classic board without a window
+func testCore(t *testing.T) *Core {
+	statsPath = filepath.Join(t.TempDir(), "stats.json")
+	c := &Core{}
+	c.setBoard(testBoard(t))
+	return c
+}
+
+// emitted collects what plinko emits from then on
+func emitted() *[]events.Event {
+	got := []events.Event{}
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "plinko" {
+			got = append(got, e)
+		}
+	})
+	return &got
+}
+
+func TestStopRefundsTokens(t *testing.T) {
+	c := testCore(t)
+	got := emitted()
+	falling := &token{playerName: "alice", Value: big.NewInt(3)}
+	c.board.release(falling)
+	// gates along the way don't change what was paid
+	falling.Value = big.NewInt(6)
+	c.tokens = []*token{falling}
+	c.queues[0].push(&token{playerName: "bob", Value: big.NewInt(5)})
+	c.queues[1].push(&token{playerName: "Alice", Value: big.NewInt(2)})
+	c.Stop()
+
+	refunds := []string{}
+	for _, e := range *got {
+		if e.Outcome == "cancelled" {
+			refunds = append(refunds, e.Player+":"+e.Payout.String()+"/"+e.Metadata["count"])
+		}
+	}
+	if s := strings.Join(refunds, " "); s != "alice:5/2 bob:5/1" {
+		t.Errorf("refunded %s, want alice:5/2 bob:5/1", s)
+	}
+	if len(c.tokens) != 0 || c.queuedCount() != 0 {
+		t.Error("tokens left after stopping")
+	}
+}
+
+func TestSmallerBoardCapsQueues(t *testing.T) {
+	c := testCore(t)
+	got := emitted()
+	players := 0
+	for i := range c.queues {
+		for k := 0; k < maxQueueLength; k++ {
+			players++
+			c.queues[i].push(&token{playerName: fmt.Sprint("p", players), Value: big.NewInt(1)})
+		}
+	}
+	smaller := testBoard(t)
+	smaller.dropPoints = smaller.dropPoints[:2]
+	c.setBoard(smaller)
+	if len(c.queues[1].Tokens) != maxQueueLength {
+		t.Errorf("merged queue has %d tokens, want %d", len(c.queues[1].Tokens), maxQueueLength)
+	}
+	rejected := 0
+	for _, e := range *got {
+		if e.Outcome == "queue_rejected" && e.Payout.Int64() == 1 {
+			rejected++
+		}
+	}
+	if want := players - 2*maxQueueLength; rejected != want {
+		t.Errorf("refunded %d tokens, want %d", rejected, want)
+	}
+
+	// and nothing more is taken until the next board is in
+	*got = nil
+	c.pendingBoard = testBoard(t)
+	if err := c.DropBall(0, big.NewInt(1), "late", "#FFFFFF", typeNormal); err == nil {
+		t.Error("took a drop with a board change waiting")
+	}
+	if len(*got) != 1 || (*got)[0].Metadata["reason"] != "board_changing" {
+		t.Errorf("late drop emitted %v", *got)
+	}
+}
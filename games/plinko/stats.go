@@ -0,0 +1,219 @@
+package plinko
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	statsShowTime = 15000.0 // ms
+	statsSaveTime = 10000.0 // ms between saves while tokens are landing
+	heatmapHeight = 400.0
+	histogramX    = 100
+	histogramY    = 200
+	histogramBarW = 60
+	histogramMaxH = 300.0
+)
+
+var statsPath = "./plinko_stats.json"
+
+type zoneStats struct {
+	Hits     int      `json:"hits"`
+	Payout   *big.Int `json:"payout"`
+	PathTime float64  `json:"pathTime"` // total ms the tokens spent falling
+}
+
+type dropPointStats struct {
+	Drops    int      `json:"drops"`
+	Wins     int      `json:"wins"`
+	Payout   *big.Int `json:"payout"`
+	PathTime float64  `json:"pathTime"` // total ms spent falling
+}
+
+type boardStats struct {
+	Zones      []*zoneStats      `json:"zones"`
+	DropPoints []*dropPointStats `json:"dropPoints"`
+}
+
+// board name -> stats
+var stats = map[string]*boardStats{}
+
+// saved every statsSaveTime rather than on every drop
+var statsDirty bool
+var statsSinceSave float64
+
+func loadStats() {
+	bs, err := os.ReadFile(statsPath)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(bs, &stats); err != nil {
+		log.Println("couldn't parse plinko stats", err.Error())
+		stats = map[string]*boardStats{}
+	}
+}
+
+func saveStats() {
+	bs, err := json.Marshal(stats)
+	if err != nil {
+		log.Println("couldn't marshal plinko stats", err.Error())
+		return
+	}
+	if err := os.WriteFile(statsPath, bs, 0644); err != nil {
+		log.Println("couldn't save plinko stats", err.Error())
+	}
+	statsDirty = false
+	statsSinceSave = 0
+}
+
+// updateStats saves the stats if anything has landed since the
+// last save and it's been long enough
+func updateStats(delta float64) {
+	statsSinceSave += delta
+	if statsDirty && statsSinceSave >= statsSaveTime {
+		saveStats()
+	}
+}
+
+// flushStats saves anything not saved yet
+func flushStats() {
+	if statsDirty {
+		saveStats()
+	}
+}
+
+// boardStatsFor gets the stats for the board, sized to match
+// it in case the layout has changed since they were saved
+func boardStatsFor(b *board) *boardStats {
+	s, ok := stats[b.name]
+	if !ok || s == nil {
+		s = &boardStats{}
+		stats[b.name] = s
+	}
+	for len(s.Zones) < len(b.zones) {
+		s.Zones = append(s.Zones, &zoneStats{})
+	}
+	s.Zones = s.Zones[:len(b.zones)]
+	for len(s.DropPoints) < len(b.dropPoints) {
+		s.DropPoints = append(s.DropPoints, &dropPointStats{})
+	}
+	s.DropPoints = s.DropPoints[:len(b.dropPoints)]
+	for _, z := range s.Zones {
+		if z.Payout == nil {
+			z.Payout = big.NewInt(0)
+		}
+	}
+	for _, d := range s.DropPoints {
+		if d.Payout == nil {
+			d.Payout = big.NewInt(0)
+		}
+	}
+	return s
+}
+
+// recordDrop adds a landed token to the stats for the board
+func recordDrop(b *board, t *token, reward *big.Int) {
+	s := boardStatsFor(b)
+	for i, z := range b.zones {
+		if z == t.zone {
+			s.Zones[i].Hits++
+			s.Zones[i].Payout.Add(s.Zones[i].Payout, reward)
+			s.Zones[i].PathTime += t.airTime
+		}
+	}
+	if t.dropPoint >= 0 && t.dropPoint < len(s.DropPoints) {
+		d := s.DropPoints[t.dropPoint]
+		d.Drops++
+		if reward.Sign() > 0 {
+			d.Wins++
+		}
+		d.Payout.Add(d.Payout, reward)
+		d.PathTime += t.airTime
+	}
+	statsDirty = true
+}
+
+func resetStats(b *board) {
+	delete(stats, b.name)
+	saveStats()
+}
+
+// drawStats shows a heatmap over the zones with how long tokens
+// take to fall into each, a histogram of how often each multiplier
+// comes up and how each drop point does
+func drawStats(b *board, shownFor float64) {
+	s := boardStatsFor(b)
+	// fade out over the last second
+	alpha := math.Min(1, (statsShowTime-shownFor)/1000)
+	fade := func(a uint8) uint8 {
+		return uint8(float64(a) * alpha)
+	}
+
+	total, most := 0, 0
+	for _, z := range s.Zones {
+		total += z.Hits
+		if z.Hits > most {
+			most = z.Hits
+		}
+	}
+	for i, z := range b.zones {
+		heat := 0.0
+		if most > 0 {
+			heat = float64(s.Zones[i].Hits) / float64(most)
+		}
+		// blue for cold zones through to red for the hot ones
+		c := rl.Color{R: uint8(heat * 255), G: 0x00, B: uint8((1 - heat) * 255), A: fade(0x88)}
+		rl.DrawRectangle(int32(z.x), int32(gameHeight-heatmapHeight), int32(z.w), int32(heatmapHeight), c)
+		pct := 0.0
+		if total > 0 {
+			pct = 100 * float64(s.Zones[i].Hits) / float64(total)
+		}
+		avgTime := 0.0
+		if s.Zones[i].Hits > 0 {
+			avgTime = s.Zones[i].PathTime / float64(s.Zones[i].Hits) / 1000
+		}
+		rl.DrawText(fmt.Sprintf("%.1f%%\n%.1fs", pct, avgTime), int32(z.x+10), int32(gameHeight-heatmapHeight+10), 36, rl.Color{R: 0xFF, G: 0xFF, B: 0xFF, A: fade(0xFF)})
+	}
+
+	// zones can share a multiplier so group them up
+	byMultiplier := map[int]int{}
+	for i, z := range b.zones {
+		byMultiplier[z.rewardValue] += s.Zones[i].Hits
+	}
+	multipliers := []int{}
+	for m := range byMultiplier {
+		multipliers = append(multipliers, m)
+	}
+	sort.Ints(multipliers)
+	rl.DrawText(fmt.Sprintf("%s - %d drops", b.name, total), histogramX, histogramY-60, 48, rl.Color{R: 0xFF, G: 0xCB, B: 0x00, A: fade(0xFF)})
+	for i, m := range multipliers {
+		h := 0.0
+		if total > 0 {
+			h = float64(byMultiplier[m]) / float64(total) * histogramMaxH
+		}
+		x := int32(histogramX + i*(histogramBarW+20))
+		base := int32(histogramY + histogramMaxH)
+		rl.DrawRectangle(x, base-int32(h), histogramBarW, int32(h), rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: fade(0xCC)})
+		rl.DrawText(fmt.Sprintf("x%d", m), x, base+10, 32, rl.Color{R: 0xFF, G: 0xFF, B: 0xFF, A: fade(0xFF)})
+		rl.DrawText(fmt.Sprint(byMultiplier[m]), x, base-int32(h)-36, 32, rl.Color{R: 0xFF, G: 0xFF, B: 0xFF, A: fade(0xFF)})
+	}
+
+	for i, dp := range b.dropPoints {
+		d := s.DropPoints[i]
+		avgPayout, avgTime := 0.0, 0.0
+		if d.Drops > 0 {
+			p, _ := new(big.Float).SetInt(d.Payout).Float64()
+			avgPayout = p / float64(d.Drops)
+			avgTime = d.PathTime / float64(d.Drops) / 1000
+		}
+		lines := fmt.Sprintf("%d drops\n%d wins\navg %.2f\n%.1fs fall", d.Drops, d.Wins, avgPayout, avgTime)
+		rl.DrawText(lines, int32(dp.x), int32(dp.y)+120, 28, rl.Color{R: 0xFF, G: 0xFF, B: 0xFF, A: fade(0xFF)})
+	}
+}
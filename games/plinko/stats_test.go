@@ -0,0 +1,43 @@
+package plinko
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsSavedOnATimer(t *testing.T) {
+	statsPath = filepath.Join(t.TempDir(), "stats.json")
+	stats = map[string]*boardStats{}
+	def, err := readBoardDef("../../boards/plinko/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd, err := def.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, airTime := range []float64{3000, 5000} {
+		tk := &token{zone: bd.zones[2], dropPoint: 1, airTime: airTime, Value: big.NewInt(1)}
+		recordDrop(bd, tk, big.NewInt(2))
+	}
+	updateStats(statsSaveTime / 2)
+	if _, err := os.Stat(statsPath); err == nil {
+		t.Fatal("saved on every drop")
+	}
+	updateStats(statsSaveTime / 2)
+	if _, err := os.Stat(statsPath); err != nil {
+		t.Fatal("not saved after statsSaveTime")
+	}
+
+	stats = map[string]*boardStats{}
+	loadStats()
+	s := boardStatsFor(bd)
+	if z := s.Zones[2]; z.Hits != 2 || z.PathTime != 8000 {
+		t.Errorf("zone stats %+v", z)
+	}
+	if d := s.DropPoints[1]; d.Drops != 2 || d.PathTime != 8000 {
+		t.Errorf("drop point stats %+v", d)
+	}
+}
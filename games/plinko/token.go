@@ -3,8 +3,8 @@ package plinko
 import (
 	"fmt"
 	"log"
+	"math"
 	"math/big"
-	"math/rand"
 
 	"github.com/MattSwanson/burtbot_overlay/shaders"
 	rl "github.com/MattSwanson/raylib-go/raylib"
@@ -15,29 +15,49 @@ const (
 	typeNormal       = 0x00
 	typeSuper        = 0x01
 	typeSecondChance = 0x02
+	trailLength      = 12 // frames
+	labelSize        = 20
 )
 
 type token struct {
 	falling     bool
-	mass        int
+	mass        float64
 	tokenType   int
 	x           float64
 	y           float64
 	vx          float64
 	vy          float64
+	angle       float64 // radians
+	spin        float64 // radians per second
 	radius      float64
 	img         rl.Texture2D
 	playerName  string
 	playerColor rl.Color
-	labelOffset fPoint
 	shader      rl.Shader
 	Value       *big.Int
+	zone        *zone
+	dropPoint   int
+	airTime     float64 // ms since release
+	slack       float64 // energy per unit mass the last integration step lost
+	trail       []vec2f // oldest first
+	gates       []*gate // already passed through
+
+	// for replaying the drop
+	dropID      string
+	seed        int64
+	roll        int // for a second chance
+	releaseTime float64
+	start       checkpoint
+	last        checkpoint // at the end of the last substep
+	startValue  *big.Int   // before any gates
+	checkpoints []checkpoint
+	path        []int
+	touched     bool // by another token this substep
 }
 
 // TODO: Update to specify a special token type to make and set the shader accordingly
 func NewToken(playerName, playerColor string, img rl.Texture2D, pos fPoint, value *big.Int, tokenType int) *token {
 	radius := float64(img.Width) / 2.0
-	labelOffset := fPoint{2.0 * radius, 0}
 	color, err := colorHexStrToColor(playerColor)
 	if err != nil {
 		log.Println("could not convert hex string to color", err.Error())
@@ -63,7 +83,6 @@ func NewToken(playerName, playerColor string, img rl.Texture2D, pos fPoint, valu
 		radius:      radius,
 		playerName:  playerName,
 		playerColor: color,
-		labelOffset: labelOffset,
 		shader:      shader,
 		Value:       value,
 	}
@@ -81,26 +100,132 @@ func (b *token) Update(delta float64) {
 		return
 	}
 	if b.falling {
+		b.airTime += delta
+		// semi-implicit euler always loses exactly this much under
+		// constant gravity, which pays for positional corrections
+		b.slack = 0.5 * math.Pow(gravity*delta/1000.0, 2)
 		b.vy = b.vy + gravity*delta/1000.0
 		b.x += b.vx * delta / 1000.0
 		b.y += b.vy * delta / 1000.0
+		b.angle += b.spin * delta / 1000.0
 	}
 }
 
+func (b *token) center() vec2f {
+	return vec2f{b.x + b.radius, b.y + b.radius}
+}
+
+func (b *token) move(d vec2f) {
+	b.x += d.x
+	b.y += d.y
+}
+
+// inertia of a solid disc
+func (b *token) inertia() float64 {
+	return 0.5 * b.mass * b.radius * b.radius
+}
+
+// pointVelocity gets the velocity of the point r from the center
+// of the token, taking its spin into account
+func (b *token) pointVelocity(r vec2f) vec2f {
+	return vec2f{b.vx - b.spin*r.y, b.vy + b.spin*r.x}
+}
+
+// applyImpulse p at the point r from the center of the token
+func (b *token) applyImpulse(p, r vec2f) {
+	b.vx += p.x / b.mass
+	b.vy += p.y / b.mass
+	b.spin += cross(r, p) / b.inertia()
+}
+
+// energy is the kinetic plus potential energy of the token,
+// with the top of the screen as zero height
+func (b *token) energy() float64 {
+	v2 := b.vx*b.vx + b.vy*b.vy
+	return 0.5*b.mass*v2 + 0.5*b.inertia()*b.spin*b.spin - b.mass*gravity*b.center().y
+}
+
+// Draw the token with whatever shader is active. Setting
+// the shader for its type is left up to the caller.
 func (b *token) Draw() {
 	if !b.falling {
 		return
 	}
-	rl.BeginShaderMode(b.shader)
-	rl.DrawTexture(b.img, int32(b.x), int32(b.y), b.playerColor)
-	rl.EndShaderMode()
-	rl.DrawText(b.playerName, int32(b.x+b.labelOffset.x), int32(b.y+b.labelOffset.y), 18, rl.Green)
+	img, tint := b.img, b.playerColor
+	avatar, hasAvatar := avatarFor(b.playerName)
+	if hasAvatar {
+		img, tint = avatar, rl.White
+	}
+	d := float32(2 * b.radius)
+	rl.DrawTexturePro(img,
+		rl.Rectangle{X: 0, Y: 0, Width: float32(img.Width), Height: float32(img.Height)},
+		rl.Rectangle{X: float32(b.x + b.radius), Y: float32(b.y + b.radius), Width: d, Height: d},
+		rl.Vector2{X: d / 2, Y: d / 2},
+		float32(b.angle*180/math.Pi),
+		tint)
+	if hasAvatar {
+		// keep the players color on show around their avatar
+		rl.DrawRing(rl.Vector2{X: float32(b.x + b.radius), Y: float32(b.y + b.radius)}, float32(b.radius)-3, float32(b.radius), 0, 360, 24, b.playerColor)
+	}
+}
+
+// recordTrail remembers where the token is for drawing its trail
+func (b *token) recordTrail() {
+	c := b.center()
+	if len(b.trail) < trailLength {
+		b.trail = append(b.trail, c)
+		return
+	}
+	copy(b.trail, b.trail[1:])
+	b.trail[len(b.trail)-1] = c
+}
+
+// DrawTrail fades out behind the token in the players color
+func (b *token) DrawTrail() {
+	if !b.falling {
+		return
+	}
+	for i, p := range b.trail {
+		f := float32(i+1) / float32(len(b.trail)+1)
+		rl.DrawCircleV(rl.Vector2{X: float32(p.x), Y: float32(p.y)}, float32(b.radius)*(0.3+0.6*f), rl.Fade(b.playerColor, 0.4*f))
+	}
+}
+
+// drawLabels puts each name next to its token wherever it won't
+// cover a label that's already been drawn, and leaves it off if
+// there's nowhere it fits
+func drawLabels(hash *spatialHash, tokens []*token) {
+	hash.clearLabels()
+	for _, b := range tokens {
+		if !b.falling {
+			continue
+		}
+		w := float32(rl.MeasureText(b.playerName, labelSize)) + 12
+		h := float32(labelSize + 4)
+		x, y, r := float32(b.x+b.radius), float32(b.y+b.radius), float32(b.radius)+4
+		spots := []rl.Rectangle{
+			{X: x + r, Y: y - h/2, Width: w, Height: h},
+			{X: x - r - w, Y: y - h/2, Width: w, Height: h},
+			{X: x - w/2, Y: y - r - h, Width: w, Height: h},
+			{X: x - w/2, Y: y + r, Width: w, Height: h},
+		}
+		for _, spot := range spots {
+			if !hash.labelFits(spot) {
+				continue
+			}
+			hash.insertLabel(spot)
+			rl.DrawRectangleRec(spot, rl.Color{R: 0x00, G: 0x00, B: 0x00, A: 0xB0})
+			rl.DrawRectangle(int32(spot.X), int32(spot.Y), 4, int32(h), b.playerColor)
+			rl.DrawText(b.playerName, int32(spot.X)+8, int32(spot.Y)+2, labelSize, rl.White)
+			break
+		}
+	}
 }
 
-func (b *token) Release() {
-	r := rand.Float64()
-	b.vx = (r - 0.5) * 3.0
-	b.falling = true
+// releaseVelocity maps r in [0, 1) to the sideways
+// speed a token is dropped with
+func releaseVelocity(r float64) float64 {
+	return (r - 0.5) * 3.0
 }
 
 func (b *token) SetVelocity(vx, vy float64) {
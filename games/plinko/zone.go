@@ -2,6 +2,7 @@ package plinko
 
 import (
 	"fmt"
+	"math"
 
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
@@ -12,28 +13,27 @@ type zone struct {
 	w           float64
 	h           float64
 	rewardValue int
-	hits        int
 	img         rl.Texture2D
 }
 
+// NewZone doesn't touch the gpu so boards can be built
+// off the main thread. The texture is made on first draw.
 func NewZone(rect fRect, n int) *zone {
-	r := uint8(float64(n) / 10.0 * 255.0)
-	img := rl.GenImageColor(int(rect.Dx()), int(rect.Dy()), rl.Color{R: r, G: 0x00, B: 0x00, A: 0x33})
 	return &zone{
 		x:           rect.min.x,
 		y:           rect.min.y,
 		w:           rect.Dx(),
 		h:           rect.Dy(),
 		rewardValue: n,
-		img:         rl.LoadTextureFromImage(img),
 	}
 }
 
 func (z *zone) Draw() {
+	if z.img.ID == 0 {
+		r := uint8(math.Min(float64(z.rewardValue)/10.0, 1) * 255.0)
+		img := rl.GenImageColor(int(z.w), int(z.h), rl.Color{R: r, G: 0x00, B: 0x00, A: 0x33})
+		z.img = rl.LoadTextureFromImage(img)
+	}
 	rl.DrawTexture(z.img, int32(z.x), int32(z.y), rl.White)
 	rl.DrawText(fmt.Sprint(z.rewardValue), int32(z.x+z.w/2), int32(gameHeight-80), 64, rl.Color{R: 0xFF, G: 0x00, B: 0x00, A: 0xFF})
 }
-
-func (z *zone) Hit() {
-	z.hits++
-}
@@ -1,33 +1,33 @@
 package slots
 
 import (
-	"context"
 	"fmt"
+	"log"
 	"math"
+	"math/big"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"math/rand"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
+	"github.com/MattSwanson/burtbot_overlay/games/slots/machine"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
 const (
-	drawOffsetX       float32       = 128.0
-	drawOffsetY       float32       = 128.0
-	spinVelocity      float32       = 1536.0
-	reelOneSpinTime   time.Duration = 5_000  // ms
-	reelTwoSpinTime   time.Duration = 7_500  // ms
-	reelThreeSpinTime time.Duration = 10_000 // ms
+	drawOffsetX    float32 = 128.0
+	drawOffsetY    float32 = 128.0
+	spinVelocity   float32 = 1536.0
+	symbolHeight           = 128
+	defaultMachine         = "classic"
+	resultShowTime         = 5_000 // ms the reels stay up after stopping
 )
 
-var sevenImg *rl.Image
-var barImg *rl.Image
-var bellImg *rl.Image
-var cherryImg *rl.Image
-var coconutImg *rl.Image
-var pearImg *rl.Image
-var watermelonImg *rl.Image
+// symbol images by file name, loaded as machines need them
+var symbolImages = map[string]*rl.Image{}
 
 var rng *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -35,91 +35,113 @@ type reel struct {
 	texture       rl.Texture2D
 	frameStartY   float32
 	currentSymbol int
-	targetSymbol  int
-	symbolOrder   []int
+	targetSymbol  int   // index into the strip it'll land on
+	symbolOrder   []int // the machine's strip for this reel
+	stopIndex     int
 	isSpinning    bool
 	velocity      float32
-	// 0 cherry - 1 watermelon - 2 pear - 3 coconut - 4 bell - 5 bar - 6 seven
+	speed         float32 // what it's actually going, to stop on time
+	window        float32 // height of the reel showing
+	elapsed       float64 // ms since the pull
+	stopAt        float64
+	stopping      bool
+	stopY         float32
+	easing        bool
+	easeDist      float32
+	easeFrom      float32
+	easeTime      float64
+	easeElapsed   float64
+	anticipating  bool
+	held          bool // keeps spinning until let go
 }
 
 type Core struct {
-	currentBet         int
-	currentUser        string
-	lastUpdate         time.Time
-	isActive           bool
-	isInfinite         bool
-	infiniteCancelFunc context.CancelFunc
-	writeChannel       chan string
-	reels              []*reel
+	currentBet  int
+	currentUser string
+	lastUpdate  time.Time
+	isActive    bool
+	isInfinite  bool
+	reels       []*reel
+	machine     *machine.Machine
+	// decided when the handle is pulled, the reels just show it
+	stops     []int
+	lines     int // pay lines played
+	result    machine.Result
+	mult      float64
+	nearMiss  bool
+	spinning  bool
+	landedFor float64 // ms since the last reel stopped
+	queue     []pull
+	freeSpins int // still to come in the bonus round
+	freeSpin  bool
+	bonusWin  int
 }
 
-func LoadSlots(wc chan string) *Core {
-
-	cherryImg = rl.LoadImage("./images/slots/cherry.png")
-	coconutImg = rl.LoadImage("./images/slots/coconut.png")
-	barImg = rl.LoadImage("./images/slots/bar.png")
-	bellImg = rl.LoadImage("./images/slots/bell.png")
-	pearImg = rl.LoadImage("./images/slots/pear.png")
-	watermelonImg = rl.LoadImage("./images/slots/watermelon.png")
-	sevenImg = rl.LoadImage("./images/slots/seven.png")
+func LoadSlots() *Core {
+	m, err := machine.Load(defaultMachine)
+	if err != nil {
+		log.Fatal("couldn't load the default slot machine: ", err)
+	}
+	c := Core{}
+	c.setMachine(m)
+	return &c
+}
 
-	reels := []*reel{
-		newReel(),
-		newReel(),
-		newReel(),
+// setMachine swaps the reels over to the ones for the machine,
+// Draw makes their textures the first time they're shown
+func (c *Core) setMachine(m *machine.Machine) {
+	for _, r := range c.reels {
+		if r.texture.ID != 0 {
+			rl.UnloadTexture(r.texture)
+		}
 	}
-	c := Core{
-		writeChannel: wc,
-		reels:        reels,
+	c.machine = m
+	c.reels = []*reel{}
+	for _, strip := range m.Strips {
+		c.reels = append(c.reels, newReel(m, strip))
 	}
-	return &c
 }
 
-func newReel() *reel {
-	nums := []int{0, 1, 2, 3, 4, 5, 6}
-	rng.Shuffle(len(nums), func(i, j int) {
-		nums[i], nums[j] = nums[j], nums[i]
-	})
-	texture := generateReelTexture(nums)
-	return &reel{
-		texture:     texture,
-		frameStartY: -64,
-		symbolOrder: nums,
+func newReel(m *machine.Machine, strip []int) *reel {
+	r := &reel{
+		symbolOrder: strip,
 		velocity:    spinVelocity,
+		window:      2 * symbolHeight, // a symbol with half of each neighbour
+	}
+	if m.Rows > 1 {
+		r.window = float32(m.Rows * symbolHeight)
 	}
+	r.frameStartY = r.position(0)
+	return r
+}
+
+// position is where the top of the window goes to put the symbol
+// in the middle of it
+func (r *reel) position(idx int) float32 {
+	return float32(idx*symbolHeight+symbolHeight/2) - r.window/2
 }
 
 // Create a composite reel texure using the order of symbols specified
 // by the int slice given
-func generateReelTexture(order []int) rl.Texture2D {
+func generateReelTexture(m *machine.Machine, order []int) rl.Texture2D {
 	buf := []byte{}
-
-	// cherry img first
 	for _, v := range order {
-		var symImage *rl.Image
-		switch v {
-		case 0:
-			symImage = cherryImg
-		case 1:
-			symImage = watermelonImg
-		case 2:
-			symImage = pearImg
-		case 3:
-			symImage = coconutImg
-		case 4:
-			symImage = bellImg
-		case 5:
-			symImage = barImg
-		case 6:
-			symImage = sevenImg
-		}
-		buf = append(buf, getRlImageBytes(symImage)...)
+		buf = append(buf, getRlImageBytes(symbolImage(m.Symbols[v].Image))...)
 	}
 
-	compImg := rl.NewImage(buf, 256, int32(len(order)*128), 1, rl.UncompressedR8g8b8a8)
+	compImg := rl.NewImage(buf, 256, int32(len(order)*symbolHeight), 1, rl.UncompressedR8g8b8a8)
 	return rl.LoadTextureFromImage(compImg)
 }
 
+func symbolImage(name string) *rl.Image {
+	if img, ok := symbolImages[name]; ok {
+		return img
+	}
+	img := rl.LoadImage(filepath.Join("./images/slots", name))
+	symbolImages[name] = img
+	return img
+}
+
 // get the color data from an image, rl.UncompressedR8g8b8a8
 func getRlImageBytes(img *rl.Image) []byte {
 	buf := []byte{}
@@ -137,94 +159,74 @@ func getRlImageBytes(img *rl.Image) []byte {
 }
 
 func (c *Core) Update(d float64) {
-	for i := range c.reels {
-		if !c.reels[i].isSpinning {
-			continue
-		}
-		c.reels[i].frameStartY -= c.reels[i].velocity * float32(d) / 1000.0
-	}
 	c.lastUpdate = time.Now()
-}
-
-func ScoreReels(reels []*reel) float64 {
-	mult := 0.0
-	if reels[0].currentSymbol == reels[1].currentSymbol &&
-		reels[0].currentSymbol == reels[2].currentSymbol {
-		switch reels[0].currentSymbol {
-		case 0:
-			mult = 4.0
-		case 1:
-			mult = 6.0
-		case 2:
-			mult = 8.0
-		case 3:
-			mult = 10.0
-		case 4:
-			mult = 30.0
-		case 5:
-			mult = 50.0
-		case 6:
-			mult = 80.0
-		}
-	} else if reels[0].currentSymbol == reels[1].currentSymbol {
-		switch reels[0].currentSymbol {
-		case 0:
-			mult = 0.6
-		case 6:
-			if reels[2].currentSymbol == 5 {
-				mult = 3.0
-			}
-		}
-	} else {
-		switch reels[0].currentSymbol {
-		case 0:
-			mult = 0.2
-		case 5:
-			if reels[1].currentSymbol == reels[2].currentSymbol {
-				switch reels[1].currentSymbol {
-				case 1:
-					mult = 1.0
-				case 2:
-					mult = 1.4
-				case 3:
-					mult = 1.8
-				case 4:
-					mult = 2.2
-				}
-			}
-		case 6:
-			if reels[1].currentSymbol == 5 &&
-				reels[2].currentSymbol == 5 {
-				mult = 2.6
-			}
-		}
+	if !c.spinning {
+		return
+	}
+	landed := true
+	for _, r := range c.reels {
+		r.update(d)
+		landed = landed && !r.isSpinning
+	}
+	if !landed {
+		return
+	}
+	c.landedFor += d
+	if c.landedFor >= resultShowTime {
+		c.finish()
 	}
-	return mult
 }
 
 func (c *Core) reset() {
+	c.spinning = false
+	c.isInfinite = false
+	c.currentUser = ""
 	for i := range c.reels {
 		c.reels[i].isSpinning = false
-		c.reels[i].frameStartY = -64
+		c.reels[i].frameStartY = c.reels[i].position(0)
 	}
 }
 
 func (c *Core) HandleMessage(args []string) {
 	switch args[0] {
-	case "start":
-		c.isActive = true
 	case "pull":
 		c.Pull(args)
-	case "stop":
-		c.isActive = false
-		c.reset()
 	case "kick":
 		if !c.isInfinite {
 			return
 		}
-		c.infiniteCancelFunc()
+		c.reels[len(c.reels)-1].held = false
 		c.isInfinite = false
+	case "machine":
+		if len(args) >= 2 {
+			c.changeMachine(args[1])
+		}
+	case "mode":
+		c.changeMode(args)
+	case "queue", "cancel":
+		c.handleQueueMessage(args)
+	}
+}
+
+// !slots machine name
+// only while nothing is spinning or queued
+func (c *Core) changeMachine(name string) {
+	if c.spinning || len(c.queue) > 0 {
+		events.Emit(events.New("slots", "", "machine_busy").
+			With("machine", name).
+			With("queued", len(c.queue)))
+		return
 	}
+	m, err := machine.Load(name)
+	if err != nil {
+		log.Println("couldn't load slot machine", err.Error())
+		events.Emit(events.New("slots", "", "machine_invalid").
+			With("machine", name))
+		return
+	}
+	c.setMachine(m)
+	events.Emit(events.New("slots", "", "machine_changed").
+		With("machine", m.Name))
 }
 
 func (c *Core) Pull(args []string) {
@@ -235,61 +237,87 @@ func (c *Core) Pull(args []string) {
 	if err != nil || bet <= 0 {
 		return
 	}
-	if rng.Intn(100) < 2 {
-		c.isInfinite = true
+	p := pull{player: args[2], bet: bet}
+	if len(args) >= 4 {
+		p.lines, _ = strconv.Atoi(args[3])
+	}
+	if c.spinning {
+		c.enqueue(p)
+		return
+	}
+	c.spin(p)
+}
+
+// spin starts the reels going for the pull
+func (c *Core) spin(p pull) {
+	c.isInfinite = !c.freeSpin && rng.Intn(100) < 2
+	c.currentUser = p.player
+	c.currentBet = p.bet
+	c.lines = p.lines
+	// every line played gets at least 1 of the bet
+	if c.lines <= 0 || c.lines > len(c.machine.Lines) {
+		c.lines = len(c.machine.Lines)
+	}
+	if c.lines > c.currentBet {
+		c.lines = c.currentBet
 	}
-	c.currentUser = args[2]
-	c.currentBet = bet
 	c.isActive = true
-	for i := range c.reels {
-		c.reels[i].targetSymbol = rng.Intn(7)
-		c.reels[i].isSpinning = true
-	}
-	go func() {
-		rm := time.Duration(500 - rng.Float64()*1000)
-		time.Sleep((reelOneSpinTime + rm) * time.Millisecond)
-		c.reels[0].isSpinning = false
-		idx := (7 - (int(c.reels[0].frameStartY)%896)/-128) % 7
-		c.reels[0].frameStartY = float32(idx*128 - 64)
-		c.reels[0].currentSymbol = c.reels[0].symbolOrder[idx]
-	}()
-	go func() {
-		rm := time.Duration(500 - rng.Float64()*1000)
-		time.Sleep((reelTwoSpinTime + rm) * time.Millisecond)
-		c.reels[1].isSpinning = false
-		idx := (7 - (int(c.reels[1].frameStartY)%896)/-128) % 7
-		c.reels[1].frameStartY = float32(idx*128 - 64)
-		c.reels[1].currentSymbol = c.reels[1].symbolOrder[idx]
-	}()
-	var ctx context.Context
-	ctx, c.infiniteCancelFunc = context.WithCancel(context.Background())
-
-	go func(ctx context.Context) {
-		rm := time.Duration(500 - rng.Float64()*1000)
-		spinTime := (reelThreeSpinTime + rm)
-		if c.isInfinite {
-			spinTime = time.Duration(1_000_000_000_000_000_000)
-		}
-	WaitLoop:
-		for {
-			select {
-			case <-ctx.Done():
-				break WaitLoop
-			case <-time.After(spinTime * time.Millisecond):
-				break WaitLoop
-			}
-		}
-		c.reels[2].isSpinning = false
-		idx := (7 - (int(c.reels[2].frameStartY)%896)/-128) % 7
-		c.reels[2].frameStartY = float32(idx*128 - 64)
-		c.reels[2].currentSymbol = c.reels[2].symbolOrder[idx]
-		mult := ScoreReels(c.reels)
-		payout := int(math.Ceil(mult * float64(c.currentBet)))
-		time.Sleep(5 * time.Second)
-		c.writeChannel <- fmt.Sprintf("slots result %s %d\n", c.currentUser, payout)
-		c.isActive = false
-		c.reset()
-	}(ctx)
+	c.spinning = true
+	c.landedFor = 0
+	c.stops = c.machine.Spin(rng)
+	c.result = c.machine.Evaluate(c.stops, c.lines)
+	c.mult = c.result.Multiplier(c.lines)
+	c.nearMiss = c.isNearMiss(c.stops)
+	for i, r := range c.reels {
+		r.start(c.stops[i], stopTime(i, len(c.reels))+500-rng.Float64()*1000)
+	}
+	last := c.reels[len(c.reels)-1]
+	if c.anticipate(c.stops) {
+		last.stopAt += anticipationTime
+		last.easeDist = anticipationSymbols * symbolHeight
+		last.anticipating = true
+	}
+	last.held = c.isInfinite
+}
+
+// finish pays out what the reels landed on, then moves on to any
+// free spins and then the next in line
+func (c *Core) finish() {
+	c.spinning = false
+	line := []string{}
+	for _, r := range c.reels {
+		line = append(line, strconv.Itoa(r.currentSymbol))
+	}
+	wins := []string{}
+	for _, w := range c.result.Wins {
+		wins = append(wins, fmt.Sprintf("%d:%g", w.Line+1, w.Multiplier))
+	}
+	payout := int(math.Ceil(c.mult * float64(c.currentBet)))
+	outcome := "loss"
+	if payout > 0 {
+		outcome = "win"
+	}
+	events.Emit(events.New("slots", c.currentUser, outcome).
+		WithPayout(big.NewInt(int64(payout))).
+		With("bet", c.currentBet).
+		With("multiplier", c.mult).
+		With("machine", c.machine.Name).
+		With("reels", strings.Join(line, ",")).
+		With("symbols", strings.Join(c.machine.Names(c.machine.Line(c.stops)), ",")).
+		With("lines", c.lines).
+		With("wins", strings.Join(wins, " ")).
+		With("scatters", c.result.Scatters).
+		With("free", c.freeSpin).
+		With("nearMiss", c.nearMiss))
+	if c.bonus(payout) {
+		return
+	}
+	if p, ok := c.next(); ok {
+		c.spin(p)
+		return
+	}
+	c.isActive = false
+	c.reset()
 }
 
 func (c *Core) Draw() {
@@ -297,19 +325,101 @@ func (c *Core) Draw() {
 		return
 	}
 	for i, reel := range c.reels {
+		if reel.texture.ID == 0 {
+			reel.texture = generateReelTexture(c.machine, reel.symbolOrder)
+		}
 		rl.DrawTexturePro(
 			reel.texture,
-			rl.Rectangle{X: 0, Y: reel.frameStartY, Width: 256, Height: 256},
+			rl.Rectangle{X: 0, Y: reel.frameStartY, Width: 256, Height: reel.window},
 			rl.Rectangle{
-				X:      drawOffsetX + 25.0 + float32(i)*256.0,
+				X:      reelX(i),
 				Y:      drawOffsetY + 0,
 				Width:  256,
-				Height: 256},
+				Height: reel.window},
 			rl.Vector2{X: 0, Y: 0},
 			0.0,
 			rl.White,
 		)
 	}
+	c.drawAnticipation()
+	c.drawWins()
+	c.drawBonus()
+	c.drawQueue()
+}
+
+func reelX(i int) float32 {
+	return drawOffsetX + 25.0 + float32(i)*256.0
+}
+
+// drawAnticipation pulses a frame around the last reel while it's
+// holding out for a big win
+func (c *Core) drawAnticipation() {
+	last := c.reels[len(c.reels)-1]
+	if !last.anticipating || !last.isSpinning {
+		return
+	}
+	for _, r := range c.reels[:len(c.reels)-1] {
+		if r.isSpinning {
+			return
+		}
+	}
+	pulse := float32(0.5 + 0.5*math.Sin(last.elapsed/100))
+	rl.DrawRectangleLinesEx(rl.Rectangle{
+		X:      reelX(len(c.reels)-1) - 6,
+		Y:      drawOffsetY - 6,
+		Width:  268,
+		Height: last.window + 12,
+	}, 6, rl.Fade(rl.Gold, 0.4+0.6*pulse))
+}
+
+func (c *Core) Start() {
+	c.isActive = true
+}
+
+// Stop gives back the bets for the spin in progress and anything
+// queued. Free spins still to come are lost.
+func (c *Core) Stop() {
+	stopped := c.queue
+	if c.spinning && !c.freeSpin {
+		stopped = append([]pull{{player: c.currentUser, bet: c.currentBet}}, stopped...)
+	}
+	c.refund(stopped)
+	if c.freeSpin || c.freeSpins > 0 {
+		// free spins already won are lost, so the bot can make
+		// them up
+		left := c.freeSpins
+		if c.spinning && c.freeSpin {
+			left++
+		}
+		events.Emit(events.New("slots", c.currentUser, "bonus_over").
+			With("won", c.bonusWin).
+			With("left", left).
+			With("bet", c.currentBet).
+			With("reason", "stopped"))
+	}
+	c.queue = nil
+	c.freeSpins = 0
+	c.freeSpin = false
+	c.bonusWin = 0
+	c.isActive = false
+	c.reset()
+}
+
+func (c *Core) Active() bool {
+	return c.isActive
+}
+
+func (c *Core) Name() string {
+	return "slots"
+}
+
+func (c *Core) Describe() string {
+	for _, r := range c.reels {
+		if r.isSpinning {
+			return fmt.Sprintf("spinning for %s, bet %d, %d queued", c.currentUser, c.currentBet, len(c.queue))
+		}
+	}
+	return "idle"
 }
 
 func (c *Core) Cleanup() {
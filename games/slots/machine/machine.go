@@ -0,0 +1,403 @@
+// Package machine is the math behind the slot machines: reel
+// strips, paytables and what a spin pays. It doesn't draw anything
+// so it can be run headless by the simulator.
+package machine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MachinesDir = "./boards/slots"
+	// Any in a pay line matches whatever symbol is there
+	Any = "any"
+)
+
+// Def is a machine as it's stored on disk
+type Def struct {
+	Name    string      `json:"name"`
+	Symbols []SymbolDef `json:"symbols"`
+	Reels   []ReelDef   `json:"reels"`
+	// symbols showing on each reel, 1 if not set
+	Rows int `json:"rows,omitempty"`
+	// the row each pay line goes through on every reel. Without any
+	// the middle row is the one line.
+	Lines [][]int `json:"lines,omitempty"`
+	// checked in order, the first one which matches is paid. Pays
+	// shorter than the line match from the leftmost reel.
+	Pays []PayDef `json:"pays"`
+	// multiplier of the whole bet by how many scatters there are,
+	// wherever they are
+	ScatterPays map[string]float64 `json:"scatterPays,omitempty"`
+	// free spins won by how many scatters there are
+	FreeSpins map[string]int `json:"freeSpins,omitempty"`
+}
+
+type SymbolDef struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	Wild    bool   `json:"wild,omitempty"` // stands in for anything but scatters
+	Scatter bool   `json:"scatter,omitempty"`
+}
+
+// ReelDef is either the strip of symbols in order or how many of
+// each symbol to put on it
+type ReelDef struct {
+	Strip   []string       `json:"strip,omitempty"`
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
+type PayDef struct {
+	Line       []string `json:"line"`
+	Multiplier float64  `json:"multiplier"`
+}
+
+// Machine is a built machine ready to spin
+type Machine struct {
+	Name    string
+	Symbols []SymbolDef
+	// symbol indexes in the order they are on each reel
+	Strips      [][]int
+	Rows        int
+	Lines       [][]int
+	Pays        []Pay
+	scatterPays map[int]float64
+	freeSpins   map[int]int
+}
+
+type Pay struct {
+	Line       []int // -1 for any
+	Multiplier float64
+}
+
+// Load reads and builds the named machine
+func Load(name string) (*Machine, error) {
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid machine name %q", name)
+	}
+	return LoadFile(filepath.Join(MachinesDir, name+".json"))
+}
+
+func LoadFile(path string) (*Machine, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def := Def{}
+	if err := json.Unmarshal(bs, &def); err != nil {
+		return nil, fmt.Errorf("couldn't parse machine %s: %w", path, err)
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	return def.Build()
+}
+
+func (d *Def) Build() (*Machine, error) {
+	if len(d.Symbols) == 0 || len(d.Reels) == 0 {
+		return nil, errors.New("machine needs symbols and reels")
+	}
+	index := map[string]int{}
+	for i, s := range d.Symbols {
+		if _, ok := index[s.Name]; ok || s.Name == Any {
+			return nil, fmt.Errorf("bad symbol name %q", s.Name)
+		}
+		index[s.Name] = i
+	}
+	lookup := func(name string) (int, error) {
+		i, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("no symbol %q", name)
+		}
+		return i, nil
+	}
+
+	m := &Machine{
+		Name:        d.Name,
+		Symbols:     d.Symbols,
+		Rows:        d.Rows,
+		scatterPays: map[int]float64{},
+		freeSpins:   map[int]int{},
+	}
+	if m.Rows <= 0 {
+		m.Rows = 1
+	}
+	if m.Rows%2 == 0 {
+		return nil, errors.New("machine needs an odd number of rows")
+	}
+	for r, rd := range d.Reels {
+		strip := []int{}
+		for _, name := range rd.Strip {
+			i, err := lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			strip = append(strip, i)
+		}
+		if len(rd.Weights) > 0 {
+			// in symbol order so the strip comes out the same every time
+			for i, s := range d.Symbols {
+				for n := 0; n < rd.Weights[s.Name]; n++ {
+					strip = append(strip, i)
+				}
+			}
+			for name := range rd.Weights {
+				if _, err := lookup(name); err != nil {
+					return nil, err
+				}
+			}
+			shuffle := rand.New(rand.NewSource(int64(r + 1)))
+			shuffle.Shuffle(len(strip), func(i, j int) {
+				strip[i], strip[j] = strip[j], strip[i]
+			})
+		}
+		if len(strip) == 0 {
+			return nil, fmt.Errorf("reel %d is empty", r)
+		}
+		m.Strips = append(m.Strips, strip)
+	}
+	for _, l := range d.Lines {
+		if len(l) != len(m.Strips) {
+			return nil, fmt.Errorf("line %v needs a row for each of the %d reels", l, len(m.Strips))
+		}
+		for _, row := range l {
+			if row < 0 || row >= m.Rows {
+				return nil, fmt.Errorf("line %v goes off the %d rows", l, m.Rows)
+			}
+		}
+		m.Lines = append(m.Lines, l)
+	}
+	if len(m.Lines) == 0 {
+		middle := make([]int, len(m.Strips))
+		for i := range middle {
+			middle[i] = m.Rows / 2
+		}
+		m.Lines = [][]int{middle}
+	}
+	for _, pd := range d.Pays {
+		if len(pd.Line) == 0 || len(pd.Line) > len(m.Strips) {
+			return nil, fmt.Errorf("pay %v needs 1 to %d symbols", pd.Line, len(m.Strips))
+		}
+		p := Pay{Multiplier: pd.Multiplier}
+		for _, name := range pd.Line {
+			i := -1
+			if name != Any {
+				var err error
+				if i, err = lookup(name); err != nil {
+					return nil, err
+				}
+			}
+			p.Line = append(p.Line, i)
+		}
+		m.Pays = append(m.Pays, p)
+	}
+	for count, mult := range d.ScatterPays {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad scatter count %q", count)
+		}
+		m.scatterPays[n] = mult
+	}
+	for count, spins := range d.FreeSpins {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad free spin count %q", count)
+		}
+		m.freeSpins[n] = spins
+	}
+	return m, nil
+}
+
+// Reels is how many reels the machine has
+func (m *Machine) Reels() int {
+	return len(m.Strips)
+}
+
+// Spin picks where each reel stops
+func (m *Machine) Spin(rng *rand.Rand) []int {
+	stops := make([]int, len(m.Strips))
+	for i, strip := range m.Strips {
+		stops[i] = rng.Intn(len(strip))
+	}
+	return stops
+}
+
+// Symbol gets the symbol on the reel at the stop, wrapping around
+func (m *Machine) Symbol(reel, stop int) int {
+	strip := m.Strips[reel]
+	return strip[((stop%len(strip))+len(strip))%len(strip)]
+}
+
+// Line gets the symbols showing on the middle row for the stops
+func (m *Machine) Line(stops []int) []int {
+	line := make([]int, len(stops))
+	for i, s := range stops {
+		line[i] = m.Symbol(i, s)
+	}
+	return line
+}
+
+// Grid gets every symbol showing, by reel then row from the top.
+// The stop is in the middle row.
+func (m *Machine) Grid(stops []int) [][]int {
+	grid := make([][]int, len(stops))
+	for i, s := range stops {
+		grid[i] = make([]int, m.Rows)
+		for row := range grid[i] {
+			grid[i][row] = m.Symbol(i, s+row-m.Rows/2)
+		}
+	}
+	return grid
+}
+
+// LineSymbols gets the symbols along the pay line
+func (m *Machine) LineSymbols(grid [][]int, line int) []int {
+	symbols := make([]int, len(grid))
+	for i, row := range m.Lines[line] {
+		symbols[i] = grid[i][row]
+	}
+	return symbols
+}
+
+// LinePay finds the first pay the line matches, returning its index
+// and multiplier, or -1 and 0 if it doesn't pay
+func (m *Machine) LinePay(line []int) (int, float64) {
+	for i, p := range m.Pays {
+		if m.matches(p.Line, line) {
+			return i, p.Multiplier
+		}
+	}
+	return -1, 0
+}
+
+// matches checks the pattern from the leftmost reel
+func (m *Machine) matches(pattern, line []int) bool {
+	for i, want := range pattern {
+		got := line[i]
+		switch {
+		case want == -1 || got == want:
+		case m.Symbols[got].Wild && !m.Symbols[want].Scatter:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Scatters counts the scatters in the symbols
+func (m *Machine) Scatters(symbols []int) int {
+	n := 0
+	for _, s := range symbols {
+		if m.Symbols[s].Scatter {
+			n++
+		}
+	}
+	return n
+}
+
+// ScatterPay is what the scatters showing pay
+func (m *Machine) ScatterPay(symbols []int) float64 {
+	return m.scatterPays[m.Scatters(symbols)]
+}
+
+// ScatterMultiplier is what n scatters pay
+func (m *Machine) ScatterMultiplier(n int) float64 {
+	return m.scatterPays[n]
+}
+
+// FreeSpinsFor is how many free spins n scatters win
+func (m *Machine) FreeSpinsFor(n int) int {
+	return m.freeSpins[n]
+}
+
+// LineWin is a pay line which paid
+type LineWin struct {
+	Line       int
+	Pay        int
+	Multiplier float64 // of the line bet
+	Length     int     // symbols from the left which made it
+}
+
+// Result is everything a spin won
+type Result struct {
+	Wins        []LineWin
+	LineMult    float64 // of the line bet, over every line
+	Scatters    int
+	ScatterMult float64 // of the whole bet
+	FreeSpins   int
+}
+
+// Multiplier is what the spin paid on the whole bet, split evenly
+// over the lines played
+func (r Result) Multiplier(lines int) float64 {
+	return r.LineMult/float64(lines) + r.ScatterMult
+}
+
+// Evaluate checks the first n pay lines and the scatters for the stops
+func (m *Machine) Evaluate(stops []int, lines int) Result {
+	if lines <= 0 || lines > len(m.Lines) {
+		lines = len(m.Lines)
+	}
+	grid := m.Grid(stops)
+	r := Result{}
+	for l := 0; l < lines; l++ {
+		pay, mult := m.LinePay(m.LineSymbols(grid, l))
+		if pay < 0 {
+			continue
+		}
+		r.Wins = append(r.Wins, LineWin{Line: l, Pay: pay, Multiplier: mult, Length: len(m.Pays[pay].Line)})
+		r.LineMult += mult
+	}
+	for _, reel := range grid {
+		r.Scatters += m.Scatters(reel)
+	}
+	r.ScatterMult = m.scatterPays[r.Scatters]
+	r.FreeSpins = m.freeSpins[r.Scatters]
+	return r
+}
+
+// Names gets the symbol names for the indexes
+func (m *Machine) Names(symbols []int) []string {
+	names := make([]string, len(symbols))
+	for i, s := range symbols {
+		names[i] = m.Symbols[s].Name
+	}
+	return names
+}
+
+// PayName describes the pay for reports
+func (m *Machine) PayName(i int) string {
+	names := []string{}
+	for _, s := range m.Pays[i].Line {
+		if s == -1 {
+			names = append(names, Any)
+			continue
+		}
+		names = append(names, m.Symbols[s].Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// ScatterCounts gets the scatter counts that pay or win free
+// spins, smallest first
+func (m *Machine) ScatterCounts() []int {
+	counts := []int{}
+	for n := range m.scatterPays {
+		counts = append(counts, n)
+	}
+	for n := range m.freeSpins {
+		if _, ok := m.scatterPays[n]; !ok {
+			counts = append(counts, n)
+		}
+	}
+	sort.Ints(counts)
+	return counts
+}
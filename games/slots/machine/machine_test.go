@@ -0,0 +1,137 @@
+package machine
+
+import (
+	"math"
+	"testing"
+)
+
+// oldScore is how the reels were scored before the paytables came
+// from the machine files
+func oldScore(a, b, c int) float64 {
+	if a == b && a == c {
+		return []float64{4, 6, 8, 10, 30, 50, 80}[a]
+	}
+	if a == b {
+		if a == 0 {
+			return 0.6
+		}
+		if a == 6 && c == 5 {
+			return 3
+		}
+		return 0
+	}
+	switch {
+	case a == 0:
+		return 0.2
+	case a == 5 && b == c && b >= 1 && b <= 4:
+		return []float64{1, 1.4, 1.8, 2.2}[b-1]
+	case a == 6 && b == 5 && c == 5:
+		return 2.6
+	}
+	return 0
+}
+
+func TestClassicPaysMatchOldScoring(t *testing.T) {
+	m, err := LoadFile("../../../boards/slots/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for a := 0; a < 7; a++ {
+		for b := 0; b < 7; b++ {
+			for c := 0; c < 7; c++ {
+				_, got := m.LinePay([]int{a, b, c})
+				if want := oldScore(a, b, c); math.Abs(got-want) > 1e-9 {
+					t.Errorf("%v pays %v, want %v", m.Names([]int{a, b, c}), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWildsAndScatters(t *testing.T) {
+	m, err := LoadFile("../../../boards/slots/wilds.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym := map[string]int{}
+	for i, s := range m.Symbols {
+		sym[s.Name] = i
+	}
+	line := func(names ...string) []int {
+		l := []int{}
+		for _, n := range names {
+			l = append(l, sym[n])
+		}
+		return l
+	}
+	if _, mult := m.LinePay(line("seven", "wild", "seven")); mult != 200 {
+		t.Errorf("wild should complete sevens, paid %v", mult)
+	}
+	if _, mult := m.LinePay(line("wild", "wild", "wild")); mult != 500 {
+		t.Errorf("three wilds paid %v", mult)
+	}
+	if _, mult := m.LinePay(line("scatter", "wild", "wild")); mult != 0 {
+		t.Errorf("wilds shouldn't stand in for scatters, paid %v", mult)
+	}
+	if got := m.ScatterPay(line("scatter", "bell", "scatter")); got != 2 {
+		t.Errorf("two scatters paid %v", got)
+	}
+}
+
+func TestSimulateRepeatable(t *testing.T) {
+	m, err := LoadFile("../../../boards/slots/classic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Simulate(m, 100_000, 42, 3)
+	b := Simulate(m, 100_000, 42, 3)
+	if a.Spins != 100_000 || a.Paid != b.Paid || a.Hits != b.Hits {
+		t.Errorf("same seed gave %v/%d and %v/%d", a.Paid, a.Hits, b.Paid, b.Hits)
+	}
+	// the exact rtp for classic works out from one of each symbol
+	// on every reel
+	exact := 0.0
+	for i := 0; i < 7*7*7; i++ {
+		_, mult := m.LinePay([]int{i / 49, i / 7 % 7, i % 7})
+		exact += mult / (7 * 7 * 7)
+	}
+	if math.Abs(a.RTP()-exact) > 0.05 {
+		t.Errorf("simulated rtp %v, expected about %v", a.RTP(), exact)
+	}
+}
+
+func TestPayLinesAndFreeSpins(t *testing.T) {
+	strip := ReelDef{Strip: []string{"a", "b", "s"}}
+	def := Def{
+		Symbols: []SymbolDef{{Name: "a"}, {Name: "b"}, {Name: "s", Scatter: true}},
+		Reels:   []ReelDef{strip, strip, strip, strip, strip},
+		Rows:    3,
+		Lines:   [][]int{{1, 1, 1, 1, 1}, {0, 0, 0, 0, 0}},
+		Pays: []PayDef{
+			{Line: []string{"a", "a", "a", "a", "a"}, Multiplier: 50},
+			{Line: []string{"a", "a", "a"}, Multiplier: 5},
+		},
+		FreeSpins: map[string]int{"5": 10},
+	}
+	m, err := def.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b in the middle row, a above and a scatter below
+	r := m.Evaluate([]int{1, 1, 1, 1, 1}, 0)
+	if len(r.Wins) != 1 || r.Wins[0].Line != 1 || r.Wins[0].Length != 5 || r.LineMult != 50 {
+		t.Errorf("top row of a should pay 50, got %+v", r)
+	}
+	if r.Scatters != 5 || r.FreeSpins != 10 || r.Multiplier(2) != 25 {
+		t.Errorf("got %d scatters, %d free spins, %vx", r.Scatters, r.FreeSpins, r.Multiplier(2))
+	}
+	// only the first line played
+	if r := m.Evaluate([]int{1, 1, 1, 1, 1}, 1); len(r.Wins) != 0 {
+		t.Errorf("unplayed line paid %+v", r.Wins)
+	}
+	// the last two reels move the scatter up into the top row
+	r = m.Evaluate([]int{1, 1, 1, 0, 0}, 0)
+	if len(r.Wins) != 1 || r.Wins[0].Length != 3 || r.LineMult != 5 {
+		t.Errorf("three a from the left should pay 5, got %+v", r)
+	}
+}
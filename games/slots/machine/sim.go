@@ -0,0 +1,122 @@
+package machine
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// maxFreeSpins stops free spins winning more free spins forever
+const maxFreeSpins = 1000
+
+// Report is what a run of simulated spins paid out, per unit bet
+// with every line played. Whatever free spins win is counted with
+// the spin which won them.
+type Report struct {
+	Spins     int
+	Paid      float64 // total multiplier over every spin
+	Hits      int     // spins which paid anything
+	MaxPay    float64
+	sumSq     float64
+	PayHits   []int       // by index into Pays, on any line
+	Scatter   map[int]int // spins by scatter count, where it pays
+	FreeSpins int         // free spins played
+	Bonuses   int         // spins which won free spins
+}
+
+// RTP is the return to player, what comes back for each unit bet
+func (r *Report) RTP() float64 {
+	return r.Paid / float64(r.Spins)
+}
+
+// HitFrequency is how often a spin pays anything
+func (r *Report) HitFrequency() float64 {
+	return float64(r.Hits) / float64(r.Spins)
+}
+
+// StdDev is the spread of what a spin pays, in units bet
+func (r *Report) StdDev() float64 {
+	mean := r.RTP()
+	return math.Sqrt(math.Max(0, r.sumSq/float64(r.Spins)-mean*mean))
+}
+
+func (r *Report) add(o *Report) {
+	r.Spins += o.Spins
+	r.Paid += o.Paid
+	r.Hits += o.Hits
+	r.sumSq += o.sumSq
+	r.MaxPay = math.Max(r.MaxPay, o.MaxPay)
+	r.FreeSpins += o.FreeSpins
+	r.Bonuses += o.Bonuses
+	for i, n := range o.PayHits {
+		r.PayHits[i] += n
+	}
+	for n, hits := range o.Scatter {
+		r.Scatter[n] += hits
+	}
+}
+
+func (m *Machine) newReport() *Report {
+	return &Report{PayHits: make([]int, len(m.Pays)), Scatter: map[int]int{}}
+}
+
+// Simulate spins the machine over and over, split between a number
+// of workers. Each worker gets its own rng seeded from seed so the
+// same seed and workers give the same report.
+func Simulate(m *Machine, spins int, seed int64, workers int) *Report {
+	if workers < 1 {
+		workers = 1
+	}
+	reports := make([]*Report, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		n := spins / workers
+		if w < spins%workers {
+			n++
+		}
+		wg.Add(1)
+		go func(w, n int) {
+			defer wg.Done()
+			reports[w] = m.simulate(n, rand.New(rand.NewSource(seed+int64(w))))
+		}(w, n)
+	}
+	wg.Wait()
+	total := m.newReport()
+	for _, r := range reports {
+		total.add(r)
+	}
+	return total
+}
+
+func (m *Machine) simulate(spins int, rng *rand.Rand) *Report {
+	r := m.newReport()
+	r.Spins = spins
+	for i := 0; i < spins; i++ {
+		mult := 0.0
+		for free, played := 1, 0; free > 0 && played < maxFreeSpins; free-- {
+			res := m.Evaluate(m.Spin(rng), len(m.Lines))
+			for _, w := range res.Wins {
+				r.PayHits[w.Pay]++
+			}
+			if res.ScatterMult > 0 || res.FreeSpins > 0 {
+				r.Scatter[res.Scatters]++
+			}
+			if res.FreeSpins > 0 && played == 0 {
+				r.Bonuses++
+			}
+			mult += res.Multiplier(len(m.Lines))
+			free += res.FreeSpins
+			if played > 0 {
+				r.FreeSpins++
+			}
+			played++
+		}
+		if mult > 0 {
+			r.Hits++
+		}
+		r.Paid += mult
+		r.sumSq += mult * mult
+		r.MaxPay = math.Max(r.MaxPay, mult)
+	}
+	return r
+}
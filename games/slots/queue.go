@@ -0,0 +1,147 @@
+package slots
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	maxQueueLength = 20
+	maxUserQueued  = 3
+	queueShown     = 6
+)
+
+// pull is a spin waiting for the machine
+type pull struct {
+	player string
+	bet    int
+	lines  int // 0 for all of them
+}
+
+// enqueue puts the pull at the back of the line, unless the line
+// is full or the player has too many in it already
+func (c *Core) enqueue(p pull) {
+	reason := ""
+	if len(c.queue) >= maxQueueLength {
+		reason = "queue_full"
+	} else if c.userQueued(p.player) >= maxUserQueued {
+		reason = "user_limit"
+	}
+	if reason != "" {
+		// the bet is there so the bot can refund it
+		events.Emit(events.New("slots", p.player, "queue_rejected").
+			WithPayout(big.NewInt(int64(p.bet))).
+			With("bet", p.bet).
+			With("reason", reason))
+		return
+	}
+	c.queue = append(c.queue, p)
+	events.Emit(events.New("slots", p.player, "queued").
+		With("bet", p.bet).
+		With("position", len(c.queue)))
+}
+
+// next takes the pull off the front of the line
+func (c *Core) next() (pull, bool) {
+	if len(c.queue) == 0 {
+		return pull{}, false
+	}
+	p := c.queue[0]
+	c.queue = c.queue[1:]
+	return p, true
+}
+
+func (c *Core) userQueued(player string) int {
+	n := 0
+	for _, p := range c.queue {
+		if strings.EqualFold(p.player, player) {
+			n++
+		}
+	}
+	return n
+}
+
+// !slots queue [username]
+// !slots cancel username
+func (c *Core) handleQueueMessage(args []string) {
+	switch args[0] {
+	case "queue":
+		e := events.New("slots", "", "queue").With("total", len(c.queue)).Status()
+		if len(args) >= 2 {
+			positions := []string{}
+			for i, p := range c.queue {
+				if strings.EqualFold(p.player, args[1]) {
+					positions = append(positions, fmt.Sprint(i+1))
+				}
+			}
+			e.Player = args[1]
+			e = e.With("positions", strings.Join(positions, " "))
+		}
+		events.Emit(e)
+	case "cancel":
+		if len(args) < 2 {
+			return
+		}
+		kept, count, value := []pull{}, 0, big.NewInt(0)
+		for _, p := range c.queue {
+			if strings.EqualFold(p.player, args[1]) {
+				count++
+				value.Add(value, big.NewInt(int64(p.bet)))
+				continue
+			}
+			kept = append(kept, p)
+		}
+		c.queue = kept
+		events.Emit(events.New("slots", args[1], "cancelled").
+			WithPayout(value).
+			With("count", count))
+	}
+}
+
+// refund emits a cancelled event for each player with pulls in
+// the list, carrying their bets back
+func (c *Core) refund(pulls []pull) {
+	players := []string{}
+	count := map[string]int{}
+	value := map[string]*big.Int{}
+	for _, p := range pulls {
+		key := strings.ToLower(p.player)
+		if _, ok := value[key]; !ok {
+			players = append(players, p.player)
+			value[key] = big.NewInt(0)
+		}
+		count[key]++
+		value[key].Add(value[key], big.NewInt(int64(p.bet)))
+	}
+	for _, player := range players {
+		key := strings.ToLower(player)
+		events.Emit(events.New("slots", player, "cancelled").
+			WithPayout(value[key]).
+			With("count", count[key]).
+			With("reason", "stopped"))
+	}
+}
+
+// drawQueue shows who's spinning and who's next up beside the reels
+func (c *Core) drawQueue() {
+	x := int32(reelX(len(c.reels)) + 40)
+	y := int32(drawOffsetY)
+	if c.currentUser != "" {
+		rl.DrawText(fmt.Sprintf("%s - %d", c.currentUser, c.currentBet), int32(reelX(0)), y-48, 40, rl.Gold)
+	}
+	if len(c.queue) == 0 {
+		return
+	}
+	rl.DrawText("Next up", x, y, 36, rl.White)
+	for i, p := range c.queue {
+		if i == queueShown {
+			rl.DrawText(fmt.Sprintf("+%d more", len(c.queue)-queueShown), x, y+int32(i+1)*36, 28, rl.LightGray)
+			break
+		}
+		rl.DrawText(fmt.Sprintf("%d. %s - %d", i+1, p.player, p.bet), x, y+int32(i+1)*36, 28, rl.LightGray)
+	}
+}
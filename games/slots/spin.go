@@ -0,0 +1,169 @@
+package slots
+
+import (
+	"math"
+)
+
+const (
+	easeSymbols = 4 // symbols passed while a reel slows to a stop
+	// when the last reel could still land a big win it spins on for
+	// a while longer and crawls in slowly
+	anticipationMult    = 10.0
+	anticipationTime    = 2_500 // ms
+	anticipationSymbols = 10
+)
+
+const (
+	firstStopTime = 5_000 // ms from the pull, give or take half a second
+	lastStopTime  = 10_000
+)
+
+// stopTime is when the reel starts to stop, spread out evenly
+// between the first and last reels
+func stopTime(reel, reels int) float64 {
+	if reels <= 1 {
+		return firstStopTime
+	}
+	return firstStopTime + float64(reel)*(lastStopTime-firstStopTime)/float64(reels-1)
+}
+
+// start sets the reel spinning, to land on the stop at the given
+// time, or later if it's being held
+func (r *reel) start(target int, stopAt float64) {
+	r.targetSymbol = target
+	r.elapsed = 0
+	r.stopAt = stopAt
+	r.stopping = false
+	r.easing = false
+	r.anticipating = false
+	r.held = false
+	r.easeDist = easeSymbols * symbolHeight
+	r.speed = r.velocity
+	r.isSpinning = true
+}
+
+// plan works out where the reel will land and how fast it has to
+// go to be ready to slow down right when it's time to stop. It
+// goes a bit faster than its velocity rather than stopping late,
+// which could be a long way round a long strip.
+func (r *reel) plan() {
+	r.stopping = true
+	remaining := math.Max(0, r.stopAt-r.elapsed) / 1000
+	travel := float32(remaining) * r.velocity
+	r.stopY = r.stopPosition(r.frameStartY - travel)
+	if remaining > 0 {
+		r.speed = (r.frameStartY - r.stopY - r.easeDist) / float32(remaining)
+	}
+}
+
+// update moves the reel along, at full speed until it's time to
+// stop, then easing out so it lands right on its target
+func (r *reel) update(d float64) {
+	if !r.isSpinning {
+		return
+	}
+	if !r.stopping && !r.held {
+		r.plan()
+	}
+	r.elapsed += d
+	if r.easing {
+		r.easeElapsed += d
+		u := math.Min(1, r.easeElapsed/r.easeTime)
+		r.frameStartY = r.stopY + (r.easeFrom-r.stopY)*float32(math.Pow(1-u, 3))
+		if u >= 1 {
+			r.land()
+		}
+		return
+	}
+	r.frameStartY -= r.speed * float32(d) / 1000.0
+	if !r.stopping || r.elapsed < r.stopAt {
+		return
+	}
+	if r.frameStartY-r.stopY <= r.easeDist {
+		// an ease out cubic starts at 3x its average speed, so this
+		// picks up at the speed the reel is already going
+		r.easing = true
+		r.easeFrom = r.frameStartY
+		r.easeElapsed = 0
+		r.easeTime = 3 * float64(r.easeFrom-r.stopY) / float64(r.speed) * 1000
+	}
+}
+
+// stopPosition is the first place past from, with room to slow
+// down, where the target sits in the middle of the window
+func (r *reel) stopPosition(from float32) float32 {
+	loop := float64(len(r.symbolOrder) * symbolHeight)
+	aligned := float64(r.position(r.targetSymbol))
+	limit := float64(from) - float64(r.easeDist)
+	return float32(aligned - math.Ceil((aligned-limit)/loop)*loop)
+}
+
+func (r *reel) land() {
+	r.isSpinning = false
+	r.easing = false
+	r.anticipating = false
+	r.frameStartY = r.position(r.targetSymbol)
+	r.stopIndex = r.targetSymbol
+	r.currentSymbol = r.symbolOrder[r.targetSymbol]
+}
+
+// anticipate is true if what's landing on the other reels could
+// still make a big win, or win a bonus, with the last one
+func (c *Core) anticipate(stops []int) bool {
+	last := len(c.reels) - 1
+	if n := c.scattersBefore(stops, last); c.bigScatters(n+1) && !c.bigScatters(n) {
+		return true
+	}
+	// with more than one line there's nearly always something
+	// the last reel could do
+	if len(c.machine.Lines) > 1 {
+		return false
+	}
+	line := c.machine.Line(stops)
+	for _, s := range c.machine.Strips[last] {
+		line[last] = s
+		if _, mult := c.machine.LinePay(line); mult >= anticipationMult {
+			return true
+		}
+	}
+	return false
+}
+
+// isNearMiss is true when the symbol just past the window on the
+// last reel would have made a big win, or won a bonus, but what
+// landed didn't
+func (c *Core) isNearMiss(stops []int) bool {
+	last := len(c.reels) - 1
+	past := stops[last] + c.machine.Rows/2 + 1
+	if c.machine.Symbols[c.machine.Symbol(last, past)].Scatter {
+		n := c.scattersBefore(stops, len(c.reels))
+		if c.bigScatters(n+1) && !c.bigScatters(n) {
+			return true
+		}
+	}
+	if len(c.machine.Lines) > 1 {
+		return false
+	}
+	if _, mult := c.machine.LinePay(c.machine.Line(stops)); mult >= anticipationMult {
+		return false
+	}
+	missed := append([]int{}, stops...)
+	missed[last]++
+	_, mult := c.machine.LinePay(c.machine.Line(missed))
+	return mult >= anticipationMult
+}
+
+// scattersBefore counts the scatters showing on the reels before
+// the one given
+func (c *Core) scattersBefore(stops []int, reel int) int {
+	n := 0
+	for _, symbols := range c.machine.Grid(stops)[:reel] {
+		n += c.machine.Scatters(symbols)
+	}
+	return n
+}
+
+// bigScatters is true if that many scatters is worth holding out for
+func (c *Core) bigScatters(n int) bool {
+	return c.machine.FreeSpinsFor(n) > 0 || c.machine.ScatterMultiplier(n) >= anticipationMult
+}
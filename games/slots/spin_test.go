@@ -0,0 +1,240 @@
+package slots
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	"github.com/MattSwanson/burtbot_overlay/games/slots/machine"
+)
+
+// testCore is a machine without any textures behind its reels
+func testCore(t *testing.T, name string) *Core {
+	m, err := machine.LoadFile("../../boards/slots/" + name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Core{machine: m}
+	for _, strip := range m.Strips {
+		c.reels = append(c.reels, newReel(m, strip))
+	}
+	return c
+}
+
+func TestReelsLandOnOutcome(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "slots" {
+			got = append(got, e)
+		}
+	})
+	for _, name := range []string{"classic", "wilds", "video"} {
+		c := testCore(t, name)
+		for seed := int64(1); seed <= 20; seed++ {
+			rng = rand.New(rand.NewSource(seed))
+			got = nil
+			c.Pull([]string{"pull", "10", "tester"})
+			if c.isInfinite {
+				c.HandleMessage([]string{"kick"})
+			}
+			want := append([]int{}, c.stops...)
+			mult := c.mult
+			landed := false
+			outOfOrder := false
+			// free spins can keep it going for a while
+			for frame := 0; frame < 60*60*30 && c.spinning; frame++ {
+				c.Update(1000.0 / 60)
+				for i := 1; i < len(c.reels) && !landed; i++ {
+					if !c.reels[i].isSpinning && c.reels[i-1].isSpinning {
+						outOfOrder = true
+					}
+				}
+				if !landed && !c.reels[len(c.reels)-1].isSpinning {
+					landed = true
+					for i, r := range c.reels {
+						if r.stopIndex != want[i] || r.frameStartY != r.position(want[i]) {
+							t.Errorf("%s seed %d: reel %d stopped at %d (%v), want %d", name, seed, i, r.stopIndex, r.frameStartY, want[i])
+						}
+					}
+					if outOfOrder {
+						t.Errorf("%s seed %d: reels stopped out of order", name, seed)
+					}
+				}
+			}
+			if c.spinning || len(got) == 0 {
+				t.Fatalf("%s seed %d: spin didn't finish", name, seed)
+			}
+			if got[0].Metadata["multiplier"] != events.New("", "", "").With("m", mult).Metadata["m"] {
+				t.Errorf("%s seed %d: paid %s, decided %v", name, seed, got[0].Metadata["multiplier"], mult)
+			}
+		}
+	}
+}
+
+func TestReelEasesWithoutJumping(t *testing.T) {
+	c := testCore(t, "classic")
+	r := c.reels[0]
+	r.start(3, 1000)
+	last := r.frameStartY
+	for r.isSpinning {
+		r.update(1000.0 / 60)
+		if !r.isSpinning {
+			// landing wraps it back round to the top of the strip,
+			// which looks just the same
+			break
+		}
+		step := last - r.frameStartY
+		if step < 0 || step > r.speed/60+0.01 {
+			t.Fatalf("reel moved %v in a frame at %vms", step, r.elapsed)
+		}
+		last = r.frameStartY
+	}
+}
+
+func TestAnticipation(t *testing.T) {
+	c := testCore(t, "classic")
+	sym := map[string]int{}
+	for i, s := range c.machine.Symbols {
+		sym[s.Name] = i
+	}
+	// finds where the symbol is on the reel
+	stop := func(reel int, name string) int {
+		for i, s := range c.machine.Strips[reel] {
+			if s == sym[name] {
+				return i
+			}
+		}
+		t.Fatalf("no %s on reel %d", name, reel)
+		return 0
+	}
+	if !c.anticipate([]int{stop(0, "seven"), stop(1, "seven"), 0}) {
+		t.Error("two sevens should hold out for the third")
+	}
+	if c.anticipate([]int{stop(0, "pear"), stop(1, "bell"), 0}) {
+		t.Error("nothing big can come of pear bell")
+	}
+	// the seven just past the pay line
+	s := stop(2, "seven") - 1
+	if s < 0 {
+		s += len(c.machine.Strips[2])
+	}
+	if !c.isNearMiss([]int{stop(0, "seven"), stop(1, "seven"), s}) {
+		t.Error("the seven just went past, that's a near miss")
+	}
+	if c.isNearMiss([]int{stop(0, "seven"), stop(1, "seven"), stop(2, "seven")}) {
+		t.Error("a win isn't a near miss")
+	}
+}
+
+func TestQueuedPullsPaidInOrder(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "slots" {
+			got = append(got, e)
+		}
+	})
+	c := testCore(t, "classic")
+	rng = rand.New(rand.NewSource(3))
+	c.Pull([]string{"pull", "10", "alice"})
+	c.Pull([]string{"pull", "20", "bob"})
+	c.Pull([]string{"pull", "30", "carol"})
+	for i := 0; i < maxUserQueued+1; i++ {
+		c.Pull([]string{"pull", "5", "dave"})
+	}
+	if len(c.queue) != 2+maxUserQueued {
+		t.Fatalf("%d queued", len(c.queue))
+	}
+	for frame := 0; frame < 60*60*10 && c.spinning; frame++ {
+		if c.isInfinite {
+			c.HandleMessage([]string{"kick"})
+		}
+		c.Update(1000.0 / 60)
+	}
+	results := []string{}
+	rejected := 0
+	for _, e := range got {
+		switch e.Outcome {
+		case "win", "loss":
+			results = append(results, e.Player+":"+e.Metadata["bet"])
+		case "queue_rejected":
+			rejected++
+		}
+	}
+	want := "alice:10 bob:20 carol:30 dave:5 dave:5 dave:5"
+	if strings.Join(results, " ") != want || rejected != 1 {
+		t.Errorf("paid %v with %d rejected, want %s with 1", results, rejected, want)
+	}
+	if c.isActive || len(c.queue) != 0 {
+		t.Error("machine should be idle once the queue is done")
+	}
+}
+
+func TestStopRefundsBets(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "slots" && e.Outcome == "cancelled" {
+			got = append(got, e)
+		}
+	})
+	c := testCore(t, "classic")
+	rng = rand.New(rand.NewSource(4))
+	c.Pull([]string{"pull", "10", "alice"})
+	c.Pull([]string{"pull", "20", "bob"})
+	c.Pull([]string{"pull", "5", "Alice"})
+	c.Stop()
+	refunds := []string{}
+	for _, e := range got {
+		refunds = append(refunds, e.Player+":"+e.Payout.String()+"/"+e.Metadata["count"])
+	}
+	if want := "alice:15/2 bob:20/1"; strings.Join(refunds, " ") != want {
+		t.Errorf("refunded %v, want %s", refunds, want)
+	}
+	if c.spinning || len(c.queue) != 0 {
+		t.Error("stop should clear the machine")
+	}
+}
+
+func TestStopEndsInfiniteSpin(t *testing.T) {
+	c := testCore(t, "classic")
+	rng = rand.New(rand.NewSource(4))
+	c.Pull([]string{"pull", "10", "alice"})
+	c.isInfinite = true
+	c.reels[len(c.reels)-1].held = true
+	c.Stop()
+	if c.isInfinite {
+		t.Fatal("still infinite after stopping")
+	}
+	c.Pull([]string{"pull", "10", "bob"})
+	if c.reels[len(c.reels)-1].held != c.isInfinite {
+		t.Error("last reel held without an infinite roll")
+	}
+	if c.isInfinite {
+		t.Error("seed rolled an infinite spin, pick another")
+	}
+}
+
+func TestStopEndsBonus(t *testing.T) {
+	var got []events.Event
+	events.Subscribe(func(e events.Event) {
+		if e.Game == "slots" && e.Outcome == "bonus_over" {
+			got = append(got, e)
+		}
+	})
+	c := testCore(t, "video")
+	rng = rand.New(rand.NewSource(4))
+	c.Pull([]string{"pull", "10", "alice"})
+	// partway through the free spins, with the next one going
+	c.freeSpin, c.freeSpins, c.bonusWin = true, 4, 30
+	c.Stop()
+	if len(got) != 1 {
+		t.Fatalf("got %d bonus_over events, want 1", len(got))
+	}
+	e := got[0]
+	if e.Player != "alice" || e.Metadata["left"] != "5" || e.Metadata["won"] != "30" || e.Metadata["reason"] != "stopped" {
+		t.Errorf("bonus_over was %s %v", e.Player, e.Metadata)
+	}
+	if c.freeSpins != 0 || c.bonusWin != 0 {
+		t.Error("bonus left over after stopping")
+	}
+}
@@ -0,0 +1,106 @@
+package slots
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+// the machine for each mode
+var modes = map[string]string{
+	"classic": "classic", // 3 reels, one line
+	"video":   "video",   // 5x3 with pay lines and free spins
+}
+
+var lineColors = []rl.Color{rl.Gold, rl.Lime, rl.SkyBlue, rl.Pink, rl.Orange, rl.Violet, rl.Red, rl.White}
+
+// !slots mode classic|video
+func (c *Core) changeMode(args []string) {
+	if len(args) < 2 {
+		return
+	}
+	name, ok := modes[strings.ToLower(args[1])]
+	if !ok {
+		names := []string{}
+		for mode := range modes {
+			names = append(names, mode)
+		}
+		sort.Strings(names)
+		events.Emit(events.New("slots", "", "mode_invalid").
+			With("modes", strings.Join(names, " ")))
+		return
+	}
+	c.changeMachine(name)
+}
+
+// bonus adds up what the free spins win and starts the next one,
+// returning true if there was another to play
+func (c *Core) bonus(payout int) bool {
+	if c.freeSpin {
+		c.bonusWin += payout
+	}
+	if won := c.result.FreeSpins; won > 0 {
+		if !c.freeSpin {
+			c.bonusWin = 0
+		}
+		c.freeSpins += won
+		events.Emit(events.New("slots", c.currentUser, "free_spins").
+			With("won", won).
+			With("left", c.freeSpins))
+	}
+	if c.freeSpins > 0 {
+		c.freeSpins--
+		c.freeSpin = true
+		c.spin(pull{player: c.currentUser, bet: c.currentBet, lines: c.lines})
+		return true
+	}
+	if c.freeSpin {
+		// each free spin was paid as it landed, this is just the total
+		events.Emit(events.New("slots", c.currentUser, "bonus_over").
+			With("won", c.bonusWin))
+		c.freeSpin = false
+		c.bonusWin = 0
+	}
+	return false
+}
+
+// drawWins traces each winning line across the reels once they've
+// all stopped, boxing the symbols which made it
+func (c *Core) drawWins() {
+	if !c.spinning || c.landedFor <= 0 {
+		return
+	}
+	for _, w := range c.result.Wins {
+		color := lineColors[w.Line%len(lineColors)]
+		points := []rl.Vector2{}
+		for i, row := range c.machine.Lines[w.Line] {
+			r := c.reels[i]
+			y := drawOffsetY + r.window/2 + float32(row-c.machine.Rows/2)*symbolHeight
+			points = append(points, rl.Vector2{X: reelX(i) + 128, Y: y})
+			if i < w.Length {
+				rl.DrawRectangleLinesEx(rl.Rectangle{
+					X:      reelX(i) + 4,
+					Y:      y - symbolHeight/2 + 4,
+					Width:  248,
+					Height: symbolHeight - 8,
+				}, 4, color)
+			}
+		}
+		for i := 1; i < len(points); i++ {
+			rl.DrawLineEx(points[i-1], points[i], 6, rl.Fade(color, 0.8))
+		}
+	}
+}
+
+// drawBonus shows how the free spins are going under the reels
+func (c *Core) drawBonus() {
+	if !c.freeSpin && c.freeSpins == 0 {
+		return
+	}
+	y := int32(drawOffsetY+c.reels[0].window) + 20
+	s := fmt.Sprintf("FREE SPINS - %d left - won %d", c.freeSpins, c.bonusWin)
+	rl.DrawText(s, int32(reelX(0)), y, 48, rl.Gold)
+}
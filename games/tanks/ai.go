@@ -0,0 +1,177 @@
+package tanks
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	aiThinkTime = 1500.0 // ms before a computer tank shoots
+	aiSimStep   = 16.0   // ms per step when trying shots out
+	aiSimSteps  = 600
+	aiMinPower  = 20.0
+	// shots tried out each frame, hard tries a couple of thousand
+	// which would hitch the overlay all at once
+	aiShotsPerFrame = 150
+)
+
+// difficulty is how carefully a computer tank aims and how much
+// it's off by when it shoots
+type difficulty struct {
+	angleStep  float64 // degrees between angles tried
+	powerStep  float64
+	angleError float64 // degrees either way
+	powerError float64 // out of 100 either way
+}
+
+var difficulties = map[string]difficulty{
+	"easy":   {angleStep: 10, powerStep: 10, angleError: 8, powerError: 10},
+	"medium": {angleStep: 5, powerStep: 5, angleError: 3, powerError: 4},
+	"hard":   {angleStep: 3, powerStep: 2, angleError: 0.5, powerError: 1},
+}
+
+// !tanks bot add <easy|medium|hard>
+func (c *Core) handleBotMessage(args []string) {
+	if len(args) < 3 || args[1] != "add" {
+		return
+	}
+	level := strings.ToLower(args[2])
+	d, ok := difficulties[level]
+	if !ok {
+		return
+	}
+	// no avatar, so it gets the plain tank
+	c.addPlayer(c.botName(level), "", &d)
+}
+
+// botName numbers the bot with the first number no tank in the
+// game has after "bot", whatever its difficulty. Players count too
+// so a bot never takes the name of someone who's joined.
+func (c *Core) botName(level string) string {
+	taken := map[int]bool{}
+	for _, t := range c.tanks {
+		name := strings.ToLower(t.playerName)
+		if i := strings.LastIndex(name, "bot"); i >= 0 {
+			if n, err := strconv.Atoi(name[i+3:]); err == nil {
+				taken[n] = true
+			}
+		}
+	}
+	n := 1
+	for taken[n] {
+		n++
+	}
+	return fmt.Sprintf("%s%sBot%d", strings.ToUpper(level[:1]), level[1:], n)
+}
+
+// updateAI aims a few shots a frame and takes the computer tank's
+// turn once it's done aiming and thinking
+func (c *Core) updateAI(delta float64) {
+	c.aiThink -= delta
+	t := c.turnOrder[0]
+	if c.aiSearch == nil || c.aiSearch.t != t {
+		target := c.aiTarget(t)
+		if target == nil {
+			return
+		}
+		c.aiSearch = newAimSearch(t, target)
+	}
+	if !c.aiSearch.step(c, aiShotsPerFrame) || c.aiThink > 0 {
+		return
+	}
+	angle, power := c.aiSearch.bestAngle, c.aiSearch.bestPower
+	c.aiSearch = nil
+	angle += (rand.Float64()*2 - 1) * t.ai.angleError
+	power += (rand.Float64()*2 - 1) * t.ai.powerError
+	c.Shoot(t.playerName, angle, math.Max(1, power), weaponShell)
+}
+
+// aiTarget picks the closest tank that isn't this one
+func (c *Core) aiTarget(t *tank) *tank {
+	var target *tank
+	best := math.Inf(1)
+	for _, o := range c.tanks {
+		if o == t {
+			continue
+		}
+		if d := math.Abs(o.x - t.x); d < best {
+			best, target = d, o
+		}
+	}
+	return target
+}
+
+// aimSearch tries out shots at the target the same way they'd fly
+// to find the one landing closest to it
+type aimSearch struct {
+	t, target *tank
+	angle     float64 // the next shot to try
+	power     float64
+	bestAngle float64
+	bestPower float64
+	best      float64 // how far from the target the best one lands
+}
+
+func newAimSearch(t, target *tank) *aimSearch {
+	return &aimSearch{
+		t:         t,
+		target:    target,
+		power:     aiMinPower,
+		bestAngle: 90,
+		bestPower: 50,
+		best:      math.Inf(1),
+	}
+}
+
+// step tries up to n more shots, returning true once it's tried
+// them all
+func (s *aimSearch) step(c *Core, n int) bool {
+	for ; n > 0 && s.angle <= 180; n-- {
+		x, y, hit := c.simulateShot(s.t, s.angle, s.power)
+		if hit != s.t {
+			d := math.Hypot(x-s.target.cx, y-s.target.cy)
+			if hit == s.target {
+				d = 0
+			}
+			if d < s.best {
+				s.best, s.bestAngle, s.bestPower = d, s.angle, s.power
+			}
+		}
+		s.power += s.t.ai.powerStep
+		if s.power > 100 {
+			s.power = aiMinPower
+			s.angle += s.t.ai.angleStep
+		}
+	}
+	return s.angle > 180
+}
+
+// aim does the whole search at once
+func (c *Core) aim(t, target *tank) (float64, float64) {
+	s := newAimSearch(t, target)
+	for !s.step(c, aiShotsPerFrame) {
+	}
+	return s.bestAngle, s.bestPower
+}
+
+// simulateShot flies a shell without changing anything and gets
+// where it ends up, and the tank it hits if any
+func (c *Core) simulateShot(t *tank, angle, power float64) (float64, float64, *tank) {
+	p := c.launch(t, angle, power)
+	for i := 0; i < aiSimSteps; i++ {
+		if hit := c.hitTank(p); hit != nil {
+			return p.x, p.y, hit
+		}
+		if p.x < -100 || p.x > float64(c.screenWidth)+100 || p.y > float64(c.screenHeight) {
+			break
+		}
+		if p.hitGround(c.terrain) || c.terrain.underwater(p.x, p.y) {
+			return p.x, p.y, nil
+		}
+		p.Update(aiSimStep, c.terrain)
+	}
+	return math.Inf(1), math.Inf(1), nil
+}
@@ -0,0 +1,88 @@
+package tanks
+
+import (
+	"testing"
+)
+
+func flatCore(w, h int, ground int, wind float64) *Core {
+	tr := newTerrain(w, h)
+	for y := ground; y < h; y++ {
+		for x := 0; x < w; x++ {
+			tr.set(x, y, true, tr.theme.surface)
+		}
+	}
+	return &Core{terrain: tr, screenWidth: w, screenHeight: h, wind: wind}
+}
+
+func testTank(name string, x, y float64) *tank {
+	t := &tank{
+		playerName:               name,
+		w:                        tankSize,
+		h:                        tankSize,
+		projectileOffsetDistance: 50,
+		health:                   maxHealth,
+	}
+	t.setPosition(x, y)
+	return t
+}
+
+func TestHardBotFindsTarget(t *testing.T) {
+	for _, wind := range []float64{-50, 0, 50} {
+		c := flatCore(2560, 1440, 1000, wind)
+		bot := testTank("HardBot1", 400, 1000)
+		d := difficulties["hard"]
+		bot.ai = &d
+		target := testTank("target", 1900, 1000)
+		c.tanks = []*tank{bot, target}
+
+		angle, power := c.aim(bot, target)
+		x, y, hit := c.simulateShot(bot, angle, power)
+		if hit != target && (x-target.cx)*(x-target.cx)+(y-target.cy)*(y-target.cy) > blastRadius[weaponShell]*blastRadius[weaponShell] {
+			t.Errorf("wind %v: shot at %v %v landed at %v, %v, target at %v, %v", wind, angle, power, x, y, target.cx, target.cy)
+		}
+	}
+}
+
+// the search spread over frames comes to the same shot as doing
+// it all at once
+func TestAimOverFrames(t *testing.T) {
+	c := flatCore(2560, 1440, 1000, 20)
+	bot := testTank("HardBot1", 400, 1000)
+	d := difficulties["hard"]
+	bot.ai = &d
+	target := testTank("target", 1900, 1000)
+	c.tanks = []*tank{bot, target}
+
+	s := newAimSearch(bot, target)
+	frames := 1
+	for !s.step(c, aiShotsPerFrame) {
+		frames++
+	}
+	if frames < 10 {
+		t.Errorf("hard only took %d frames to aim", frames)
+	}
+	angle, power := c.aim(bot, target)
+	if angle != s.bestAngle || power != s.bestPower {
+		t.Errorf("spread out aimed %v %v, all at once %v %v", s.bestAngle, s.bestPower, angle, power)
+	}
+}
+
+func TestBotNamesAreUnique(t *testing.T) {
+	c := flatCore(100, 100, 50, 0)
+	easy, hard := difficulties["easy"], difficulties["hard"]
+	c.tanks = []*tank{testTank("EasyBot1", 0, 0), testTank("HardBot2", 0, 0), testTank("someone", 0, 0)}
+	c.tanks[0].ai, c.tanks[1].ai = &easy, &hard
+	if name := c.botName("hard"); name != "HardBot3" {
+		t.Errorf("next bot is %s", name)
+	}
+	// EasyBot1 died
+	c.tanks = c.tanks[1:]
+	if name := c.botName("hard"); name != "HardBot1" {
+		t.Errorf("next bot after one left is %s", name)
+	}
+	// someone joined with a bot's name
+	c.tanks = append(c.tanks, testTank("hardbot1", 0, 0))
+	if name := c.botName("hard"); name != "HardBot3" {
+		t.Errorf("next bot with a player called hardbot1 is %s", name)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
 	"github.com/MattSwanson/burtbot_overlay/sound"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
@@ -15,6 +17,11 @@ import (
 const (
 	maxShotVelocity = 1500 // ?
 	slopeCalcOffset = 20
+	craterRadius    = 40.0
+	maxSlope        = 0.9  // radians a tank can sit on without sliding
+	slideSpeed      = 60.0 // px per second
+	safeFall        = 30.0 // px a tank can fall without taking damage
+	fallDamage      = 0.5  // per px fallen past that
 )
 
 var boomImg rl.Texture2D
@@ -24,21 +31,36 @@ type Core struct {
 	currentTurn   int
 	turnOrder     []*tank
 	playersJoined int
-	terrainImg    rl.Texture2D
-	heightMap     []float64
+	terrain       *terrain
 	screenWidth   int
 	screenHeight  int
 	wind          float64
-	projectile    *projectile
+	projectiles   []*projectile
+	fires         []*fire
+	shotFired     bool
+	damageLog     []*damageEntry
+	shotWeapon    weapon
+	shotDamage    map[string]float64 // by player, for the shot in the air
+	shotKills     []string
+	turnPlayer    *tank   // whose turn the clock is running for
+	turnTimer     float64 // ms left
+	turnTime      float64 // seconds each player gets
+	maxSkips      int
+	aiThink       float64 // ms left before a computer tank shoots
+	aiSearch      *aimSearch
+	round         int
+	hadTurn       map[*tank]bool // this round
 	gameStarted   bool
 	gameOver      bool
 	winner        string
-	winnerImg     rl.Texture2D
+	winnerImg     *imagecache.Image
 	showBoom      bool
 	boomX         float64
 	boomY         float64
 	boomTime      time.Time
 	running       bool
+	shooter       *tank
+	shooterName   string
 }
 
 func rotateTurns(s []*tank) []*tank {
@@ -60,23 +82,23 @@ func Load(sWidth, sHeight float64) *Core {
 	boomImg = rl.LoadTexture("./images/tanks/tanks_boom.png")
 
 	tanks := []*tank{}
-	terrain, heightMap := generateTerrain(int(sWidth), int(sHeight))
 
 	w := (rand.Float64() - 0.5) * 100
 	return &Core{
 		tanks:        tanks,
-		terrainImg:   terrain,
-		heightMap:    heightMap,
+		terrain:      generateTerrain(int(sWidth), int(sHeight), defaultStyle, randomSeed()),
 		wind:         w,
 		screenWidth:  int(sWidth),
 		screenHeight: int(sHeight),
+		turnTime:     defaultTurnTime,
+		maxSkips:     defaultMaxSkips,
 	}
 }
 
 func (c *Core) PlaceTank(num int, xpos int) {
-	y := c.heightMap[xpos]
-	ymo := c.heightMap[xpos-slopeCalcOffset]
-	ypo := c.heightMap[xpos+slopeCalcOffset]
+	y := c.terrain.surface(xpos)
+	ymo := c.terrain.surface(xpos - slopeCalcOffset)
+	ypo := c.terrain.surface(xpos + slopeCalcOffset)
 	s := (ymo - ypo) / (2 * slopeCalcOffset)
 	c.tanks[num].setAngle(-math.Atan(s))
 	c.tanks[num].setPosition(float64(xpos), y)
@@ -86,25 +108,31 @@ func (c *Core) Draw() {
 	if !c.running {
 		return
 	}
+	c.terrain.drawSky()
 	if c.gameStarted {
 		for i, t := range c.turnOrder {
 			t.DrawTurn(int32(i))
 		}
 	}
-	rl.DrawTexture(c.terrainImg, 0, 0, rl.White)
+	rl.DrawTexture(c.terrain.tex, 0, 0, rl.White)
 	for _, tank := range c.tanks {
 		myTurn := c.turnOrder[0] == tank
 		tank.Draw(myTurn)
 	}
-	if c.projectile != nil {
-		c.projectile.Draw()
+	for _, p := range c.projectiles {
+		p.Draw()
 	}
+	c.drawFires()
+	c.terrain.drawWater()
+	c.drawTurnTimer()
+	c.drawDamageLog()
 	if c.showBoom {
 		rl.DrawTexture(boomImg, int32(c.boomX), int32(c.boomY), rl.White)
 	}
 	if c.gameStarted {
-		s := fmt.Sprintf("%s's turn. !tanks shoot <angle(degrees)> <velocity(1-100)>", c.turnOrder[0].playerName)
+		s := fmt.Sprintf("%s's turn. !tanks shoot <angle(degrees)> <velocity(1-100)> [weapon]", c.turnOrder[0].playerName)
 		rl.DrawText(s, 75, 1350, 48, rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: 0xFF})
+		rl.DrawText(c.turnOrder[0].inventory(), 75, 1300, 32, rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: 0xFF})
 	} else {
 		rl.DrawText("type '!tanks join' to join the game!", 75, 1350, 48, rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: 0xFF})
 	}
@@ -119,17 +147,13 @@ func (c *Core) Draw() {
 	if c.gameOver {
 		s := fmt.Sprintf("%s is the winner!", c.winner)
 		rl.DrawText(s, 410, int32(c.screenHeight/2), 48, rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: 0xFF})
-		rl.DrawTexture(c.winnerImg, 100, int32(c.screenHeight/2-int(float32(c.winnerImg.Width)/2.0)), rl.White)
+		img := c.winnerImg.Texture()
+		rl.DrawTexture(img, 100, int32(c.screenHeight/2-int(float32(img.Width)/2.0)), rl.White)
 	}
 }
 
 func (c *Core) HandleMessage(args []string) {
-	if args[0] == "start" {
-		c.running = true
-	} else if args[0] == "stop" {
-		c.running = false
-		c.Reset()
-	} else if args[0] == "join" {
+	if args[0] == "join" {
 		if len(args) < 3 {
 			return
 		}
@@ -145,9 +169,32 @@ func (c *Core) HandleMessage(args []string) {
 		if err != nil {
 			return
 		}
-		c.Shoot(args[1], a, v)
+		w := weaponShell
+		if len(args) >= 5 {
+			var ok bool
+			if w, ok = parseWeapon(args[4]); !ok {
+				return
+			}
+		}
+		c.Shoot(args[1], a, v, w)
 	} else if args[0] == "begin" {
 		c.Begin()
+	} else if args[0] == "leave" {
+		if len(args) < 2 {
+			return
+		}
+		c.leave(args[1])
+	} else if args[0] == "timer" {
+		c.setTimer(args)
+	} else if args[0] == "shield" {
+		if len(args) < 2 {
+			return
+		}
+		c.buyShield(args[1])
+	} else if args[0] == "terrain" {
+		c.setTerrain(args)
+	} else if args[0] == "bot" {
+		c.handleBotMessage(args)
 	}
 }
 
@@ -155,131 +202,243 @@ func (c *Core) Update(delta float64){
 	if !c.running {
 		return
 	}
-	if c.projectile == nil {
+	c.terrain.upload()
+	if c.gameStarted && c.settleTanks(delta) {
 		return
 	}
-
-	for v, tank := range c.tanks {
-		maxDist := math.Sqrt(tank.w*tank.w+tank.h*tank.h) + 8
-		dst := math.Sqrt((tank.cx-c.projectile.x)*(tank.cx-c.projectile.x) + (tank.cy-c.projectile.y)*(tank.cy-c.projectile.y))
-		if dst > maxDist {
-			continue
-		}
-
-		for i := 0; i < 32; i++ {
-			cpx := c.projectile.x + radius*math.Cos(float64(i)*2.0/32.0*math.Pi)
-			cpy := c.projectile.y - radius*math.Sin(float64(i)*2.0/32.0*math.Pi)
-			if tank.bounds[0].IsLeft(cpx, cpy) > 0 && tank.bounds[1].IsLeft(cpx, cpy) > 0 && tank.bounds[2].IsLeft(cpx, cpy) > 0 && tank.bounds[3].IsLeft(cpx, cpy) > 0 {
-				c.projectile = nil
-				c.boomX, c.boomY = tank.cx-float64(boomImg.Width)/2, tank.cy-float64(boomImg.Width)/2
-				c.boomTime = time.Now()
-				c.showBoom = true
-				go func() {
-					time.Sleep(time.Second)
-					c.showBoom = false
-				}()
-				c.playersJoined--
-				c.tanks = removeTank(c.tanks, v)
-				if len(c.tanks) == 1 {
-					// win screen
-					c.winner = c.tanks[0].playerName
-					c.winnerImg = c.tanks[0].img
-					c.gameOver = true
-					c.gameStarted = false
-					sound.Play("indigo")
-					go func() {
-						time.Sleep(5 * time.Second)
-						c.gameOver = false
-					}()
-					c.Reset()
-					return
-				} else {
-					sound.Play("sosumi")
-				}
-
-				if tank != c.turnOrder[0] {
-					c.removeTankFromTurnOrder(tank)
-					c.turnOrder = rotateTurns(c.turnOrder)
-				} else {
-					c.removeTankFromTurnOrder(tank)
-				}
-				return
-			}
-		}
+	if c.updateTurn(delta) {
+		return
+	}
+	if !c.shotFired {
+		return
+	}
+	if c.updateProjectiles(delta) || c.updateFires(delta) {
+		return
+	}
+	if len(c.projectiles) == 0 && len(c.fires) == 0 {
+		c.finishShot()
+		c.endTurn()
 	}
+}
 
-	//check for oob
-	if c.projectile.x < -100 || c.projectile.x > float64(c.screenWidth)+100 || c.projectile.y > float64(c.screenHeight) || c.projectile.y < -2000 {
-		c.projectile = nil
-		// c.advanceTurn(-1)
+// endTurn moves the shooter to the back of the line, unless
+// they've already been taken out of it
+func (c *Core) endTurn() {
+	if len(c.turnOrder) > 0 && c.turnOrder[0] == c.shooter {
 		c.turnOrder = rotateTurns(c.turnOrder)
-		return
 	}
+}
 
-	// ground collision
-	for i := 0; i < 6; i++ {
-		// find the x center of the projectile from the top left corner (origin)
-		cpx := int(c.projectile.x + radius*math.Cos(float64(i)*2.0/6.0*math.Pi))
-		if cpx < 0 || cpx >= 2560 {
+func (c *Core) boom(x, y float64) {
+	c.boomX, c.boomY = x-float64(boomImg.Width)/2, y-float64(boomImg.Width)/2
+	c.boomTime = time.Now()
+	c.showBoom = true
+	go func() {
+		time.Sleep(time.Second)
+		c.showBoom = false
+	}()
+}
+
+// eliminate takes the tank out of the game. Returns true if
+// that leaves a winner, in which case the game has been reset.
+func (c *Core) eliminate(t *tank, by string) bool {
+	if c.shotFired {
+		c.shotKills = append(c.shotKills, t.playerName)
+	}
+	events.Emit(events.New("tanks", t.playerName, "eliminated").
+		With("by", by))
+	return c.removePlayer(t)
+}
+
+// removePlayer takes the tank out of the game for whatever reason.
+// Returns true if that leaves a winner, in which case the game
+// has been reset.
+func (c *Core) removePlayer(t *tank) bool {
+	for i, tank := range c.tanks {
+		if tank == t {
+			c.tanks = removeTank(c.tanks, i)
 			break
 		}
-		// then the y center
-		cpy := c.projectile.y + radius*math.Sin(float64(i)*2.0/6.0*math.Pi)
-		// if the y position is lower than the height of the terrain at that x pos...
-		if cpy >= c.heightMap[cpx] {
-			// thunk
-			sound.Play("kerplunk")
-			c.projectile = nil
-			//c.advanceTurn(-1)
-			c.turnOrder = rotateTurns(c.turnOrder)
-			return
+	}
+	c.removeTankFromTurnOrder(t)
+	c.playersJoined--
+	if c.gameStarted && len(c.tanks) == 1 {
+		if c.shotFired {
+			c.finishShot()
 		}
+		// win screen
+		c.winner = c.tanks[0].playerName
+		events.Emit(events.New("tanks", c.winner, "winner"))
+		c.winnerImg = c.tanks[0].avatar
+		c.gameOver = true
+		c.gameStarted = false
+		sound.Play("indigo")
+		go func() {
+			time.Sleep(5 * time.Second)
+			c.gameOver = false
+		}()
+		c.Reset()
+		return true
 	}
+	sound.Play("sosumi")
+	return false
+}
 
-	c.projectile.Update(delta)
+// settleTanks drops tanks into any holes blown out from under
+// them and slides them off slopes too steep to sit on. Returns
+// true if a fall finished the game.
+func (c *Core) settleTanks(delta float64) bool {
+	dt := delta / 1000
+	for _, t := range append([]*tank{}, c.tanks...) {
+		if c.terrain.underwater(t.x, t.y-t.h/2) {
+			// sunk
+			if c.eliminate(t, c.shooterName) {
+				return true
+			}
+			continue
+		}
+		ground := c.terrain.groundBelow(int(t.x), t.y)
+		if ground > t.y+0.5 {
+			if !t.falling {
+				t.falling = true
+				t.fallStart = t.y
+				t.vy = 0
+			}
+			t.vy += gravity * dt
+			t.setPosition(t.x, math.Min(t.y+t.vy*dt, ground))
+			if t.y < ground {
+				continue
+			}
+		}
+		if t.falling {
+			t.falling = false
+			// nothing to land on
+			if ground >= float64(c.screenHeight) {
+				if c.eliminate(t, c.shooterName) {
+					return true
+				}
+				continue
+			}
+			if c.damage(t, (t.y-t.fallStart-safeFall)*fallDamage, c.shooterName, "fall") {
+				return true
+			}
+			if t.health <= 0 {
+				continue
+			}
+		}
+		c.slideTank(t, dt)
+	}
+	return false
+}
 
-	return
+// slideTank tilts the tank to match the ground under it and
+// moves it downhill if it's too steep
+func (c *Core) slideTank(t *tank, dt float64) {
+	x := int(t.x)
+	ymo := c.terrain.groundBelow(x-slopeCalcOffset, t.y-slopeCalcOffset)
+	ypo := c.terrain.groundBelow(x+slopeCalcOffset, t.y-slopeCalcOffset)
+	a := -math.Atan((ymo - ypo) / (2 * slopeCalcOffset))
+	nx := t.x
+	if math.Abs(a) > maxSlope {
+		// larger y is further down
+		dir := 1.0
+		if ymo > ypo {
+			dir = -1.0
+		}
+		nx = math.Max(slopeCalcOffset, math.Min(float64(c.screenWidth-slopeCalcOffset), t.x+dir*slideSpeed*dt))
+	}
+	if nx != t.x || a != t.a {
+		t.a = a
+		t.setPosition(nx, t.y)
+	}
 }
 
 func (c *Core) Reset() {
 	c.gameStarted = false
-	c.terrainImg, c.heightMap = generateTerrain(c.screenWidth, c.screenHeight)
+	c.terrain.unload()
+	c.terrain = generateTerrain(c.screenWidth, c.screenHeight, c.terrain.style, randomSeed())
 	c.tanks = []*tank{}
 	c.playersJoined = 0
 	c.turnOrder = []*tank{}
+	c.round = 0
+	c.hadTurn = nil
 	c.wind = (rand.Float64() - 0.5) * 100
 	c.showBoom = false
+	c.projectiles = nil
+	c.fires = nil
+	c.shotFired = false
+	c.turnPlayer = nil
+	c.damageLog = nil
 }
 
-func (c *Core) Shoot(player string, angle float64, totalVelocity float64) {
-	if !c.gameStarted || !strings.HasPrefix(c.turnOrder[0].playerName, player) || c.projectile != nil {
+func (c *Core) Shoot(player string, angle float64, totalVelocity float64, w weapon) {
+	if !c.gameStarted || !strings.HasPrefix(c.turnOrder[0].playerName, player) || c.shotFired {
 		return
 	}
 	if totalVelocity < 1 {
 		return
 	}
+	if w != weaponShell {
+		if c.turnOrder[0].ammo[w] <= 0 {
+			return
+		}
+		c.turnOrder[0].ammo[w]--
+	}
+	c.turnOrder[0].skips = 0
+	c.shooter = c.turnOrder[0]
+	c.shooterName = c.shooter.playerName
+	p := c.launch(c.shooter, angle, totalVelocity)
+	c.shooter.lastShotAngle = angle*math.Pi/180.0 - c.shooter.a
+	p.weapon = w
+	c.projectiles = []*projectile{p}
+	c.shotFired = true
+	c.shotWeapon = w
+	c.shotDamage = map[string]float64{}
+	c.shotKills = []string{}
+}
+
+// launch makes the projectile for a shot from the tank, with the
+// angle in degrees and the velocity out of 100
+func (c *Core) launch(t *tank, angle, totalVelocity float64) *projectile {
 	totalVelocity = math.Min(totalVelocity, 100)
 	totalVelocity = maxShotVelocity * totalVelocity / 100
-	angle = angle*math.Pi/180.0 - c.turnOrder[0].a
-	pSpawnOffsetX := math.Cos(angle) * c.turnOrder[0].projectileOffsetDistance
-	pSpawnOffsetY := math.Sin(angle) * c.turnOrder[0].projectileOffsetDistance
-	c.turnOrder[0].lastShotAngle = angle
-	p := NewProjectile(c.turnOrder[0].cx+pSpawnOffsetX,
-		c.turnOrder[0].cy-pSpawnOffsetY,
+	angle = angle*math.Pi/180.0 - t.a
+	pSpawnOffsetX := math.Cos(angle) * t.projectileOffsetDistance
+	pSpawnOffsetY := math.Sin(angle) * t.projectileOffsetDistance
+	p := NewProjectile(t.cx+pSpawnOffsetX,
+		t.cy-pSpawnOffsetY,
 		c.wind, false)
 	vx := math.Cos(angle) * totalVelocity
 	vy := -math.Sin(angle) * totalVelocity
 	p.SetVelocity(vx, vy)
-	c.projectile = p
+	return p
 }
 
 func (c *Core) AddPlayer(playerName string, imgURL string) {
+	c.addPlayer(playerName, imgURL, nil)
+}
+
+// addPlayer puts a tank in the game, run by the computer if ai
+// is set. Returns nil if the player is already in.
+func (c *Core) addPlayer(playerName string, imgURL string, ai *difficulty) *tank {
 	if strings.HasPrefix(playerName, "BurtStanton") {
 		playerName += fmt.Sprint(len(c.tanks))
 	}
+	for _, o := range c.tanks {
+		if strings.EqualFold(o.playerName, playerName) {
+			events.Emit(events.New("tanks", playerName, "join_rejected").
+				With("reason", "already_joined"))
+			return nil
+		}
+	}
 	xpos := 0
 	ind := 0
 	t := NewTank(playerName, imgURL)
+	t.ai = ai
+	defer events.Emit(events.New("tanks", playerName, "joined").
+		With("players", len(c.tanks)+1).
+		With("midGame", c.gameStarted).
+		With("bot", ai != nil))
 	if c.gameStarted {
 		l := slopeCalcOffset - 1
 		maxDist := int(c.tanks[0].x)
@@ -323,9 +482,10 @@ func (c *Core) AddPlayer(playerName string, imgURL string) {
 	if !c.gameStarted {
 		t.setPosition(0+t.w/2, t.h*float64(c.playersJoined-1)+t.h)
 		c.tanks = append(c.tanks, t)
-		return
+		return t
 	}
 	c.PlaceTank(ind, xpos)
+	return t
 }
 
 func (c *Core) Begin() {
@@ -334,12 +494,37 @@ func (c *Core) Begin() {
 	}
 	r := (c.screenWidth - 2*slopeCalcOffset) / (c.playersJoined * 2)
 	for i := 0; i < c.playersJoined; i++ {
-		xpos := rand.Intn(r) + r*(i*2) + slopeCalcOffset
+		lo := r*(i*2) + slopeCalcOffset
+		xpos := c.terrain.dryNear(rand.Intn(r)+lo, lo, lo+2*r)
 		c.PlaceTank(i, xpos)
 	}
 	c.gameStarted = true
 }
 
+func (c *Core) Start() {
+	c.running = true
+}
+
+func (c *Core) Stop() {
+	c.running = false
+	c.Reset()
+}
+
+func (c *Core) Active() bool {
+	return c.running
+}
+
+func (c *Core) Name() string {
+	return "tanks"
+}
+
+func (c *Core) Describe() string {
+	if !c.gameStarted {
+		return fmt.Sprintf("waiting to begin, %d joined", c.playersJoined)
+	}
+	return fmt.Sprintf("%d tanks left, %s's turn", len(c.tanks), c.turnOrder[0].playerName)
+}
+
 func (c *Core) Cleanup() {
 
 }
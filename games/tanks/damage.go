@@ -0,0 +1,168 @@
+package tanks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	shieldStrength = 50.0 // damage a shield soaks up before it's gone
+	damageLogShown = 6
+	healthBarH     = 6
+)
+
+// damage done at the center of the blast, falling off to nothing
+// at the edge of it
+var blastDamage = map[weapon]float64{
+	weaponShell:   50,
+	weaponCluster: 25,
+	weaponMIRV:    50,
+	weaponRoller:  55,
+	weaponDigger:  30,
+	weaponNapalm:  10,
+	weaponBomblet: 20,
+}
+
+type damageEntry struct {
+	by     string
+	to     string
+	cause  string
+	amount float64
+	when   time.Time
+}
+
+// splash hurts every tank caught in the blast, more the closer it
+// is to the middle. Returns true if the game is over.
+func (c *Core) splash(x, y float64, w weapon) bool {
+	r := blastRadius[w]
+	for _, t := range append([]*tank{}, c.tanks...) {
+		// measured to the nearest side of the tank, roughly
+		d := math.Max(0, math.Hypot(t.cx-x, t.cy-y)-t.w/2)
+		if d >= r {
+			continue
+		}
+		if c.damage(t, blastDamage[w]*(1-d/r), c.shooterName, w.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// damage takes health off the tank, after the shield has taken
+// what it can, eliminating it if there's none left. Returns true
+// if the game is over.
+func (c *Core) damage(t *tank, amount float64, by, cause string) bool {
+	if amount <= 0 || t.health <= 0 {
+		return false
+	}
+	c.logDamage(by, t.playerName, cause, amount)
+	if c.shotFired {
+		c.shotDamage[t.playerName] += amount
+	}
+	absorbed := math.Min(t.shield, amount)
+	t.shield -= absorbed
+	t.health -= amount - absorbed
+	if t.health <= 0 {
+		return c.eliminate(t, by)
+	}
+	return false
+}
+
+// finishShot lets the bot know what the shot did, once everything
+// from it has landed
+func (c *Core) finishShot() {
+	c.shotFired = false
+	result, total, hits := "miss", 0.0, []string{}
+	for name, amount := range c.shotDamage {
+		hits = append(hits, fmt.Sprintf("%s:%.0f", name, amount))
+		if name != c.shooterName {
+			total += amount
+			result = "hit"
+		}
+	}
+	sort.Strings(hits)
+	events.Emit(events.New("tanks", c.shooterName, "shot").
+		With("result", result).
+		With("weapon", c.shotWeapon).
+		With("damage", fmt.Sprintf("%.0f", total)).
+		With("hits", strings.Join(hits, " ")).
+		With("eliminated", strings.Join(c.shotKills, " ")))
+}
+
+// logDamage adds to the damage log, running together damage which
+// keeps coming from the same place like fire
+func (c *Core) logDamage(by, to, cause string, amount float64) {
+	if n := len(c.damageLog); n > 0 {
+		last := c.damageLog[n-1]
+		if last.by == by && last.to == to && last.cause == cause && time.Since(last.when) < time.Second {
+			last.amount += amount
+			last.when = time.Now()
+			return
+		}
+	}
+	c.damageLog = append(c.damageLog, &damageEntry{
+		by:     by,
+		to:     to,
+		cause:  cause,
+		amount: amount,
+		when:   time.Now(),
+	})
+}
+
+// !tanks shield <player>
+// one shield per player each round, the bot takes care of paying for it
+func (c *Core) buyShield(player string) {
+	for _, t := range c.tanks {
+		if !strings.EqualFold(t.playerName, player) {
+			continue
+		}
+		if t.shieldBought {
+			events.Emit(events.New("tanks", t.playerName, "shield_rejected").
+				With("reason", "already_bought"))
+			return
+		}
+		t.shieldBought = true
+		t.shield = shieldStrength
+		events.Emit(events.New("tanks", t.playerName, "shield").
+			With("strength", shieldStrength))
+		return
+	}
+}
+
+func (t *tank) drawHealth() {
+	x := int32(t.x - t.w/2)
+	y := int32(t.y - t.h - 20)
+	w := int32(t.w)
+	rl.DrawRectangle(x, y, w, healthBarH, rl.Maroon)
+	hw := int32(t.w * math.Max(0, t.health) / maxHealth)
+	color := rl.Green
+	if t.health < maxHealth/3 {
+		color = rl.Red
+	} else if t.health < 2*maxHealth/3 {
+		color = rl.Yellow
+	}
+	rl.DrawRectangle(x, y, hw, healthBarH, color)
+	if t.shield > 0 {
+		sw := int32(t.w * t.shield / shieldStrength)
+		rl.DrawRectangle(x, y-healthBarH-2, sw, healthBarH-2, rl.SkyBlue)
+		rl.DrawCircleLines(int32(t.cx), int32(t.cy), float32(t.w*0.75), rl.Fade(rl.SkyBlue, 0.6))
+	}
+}
+
+func (c *Core) drawDamageLog() {
+	start := int(math.Max(0, float64(len(c.damageLog)-damageLogShown)))
+	x := int32(c.screenWidth - 700)
+	for i, d := range c.damageLog[start:] {
+		s := fmt.Sprintf("%s hit %s for %.0f (%s)", d.by, d.to, d.amount, d.cause)
+		if d.by == d.to {
+			s = fmt.Sprintf("%s hit themselves for %.0f (%s)", d.by, d.amount, d.cause)
+		}
+		rl.DrawText(s, x, int32(150+i*30), 24, rl.Orange)
+	}
+}
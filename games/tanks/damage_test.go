@@ -0,0 +1,34 @@
+package tanks
+
+import (
+	"testing"
+)
+
+func TestShieldEachRound(t *testing.T) {
+	c := flatCore(1000, 500, 400, 0)
+	a, b := testTank("a", 200, 400), testTank("b", 800, 400)
+	c.tanks = []*tank{a, b}
+	c.turnOrder = []*tank{a, b}
+	c.gameStarted = true
+	c.turnTime = defaultTurnTime
+
+	c.updateTurn(16)
+	c.buyShield("a")
+	if !a.shieldBought || c.round != 1 {
+		t.Fatalf("round %d, bought %v", c.round, a.shieldBought)
+	}
+	c.turnOrder = rotateTurns(c.turnOrder)
+	c.updateTurn(16)
+	a.shield = 0
+	c.buyShield("a")
+	if a.shield != 0 || c.round != 1 {
+		t.Errorf("bought a second shield in round %d", c.round)
+	}
+	// back round to a
+	c.turnOrder = rotateTurns(c.turnOrder)
+	c.updateTurn(16)
+	c.buyShield("a")
+	if c.round != 2 || a.shield != shieldStrength {
+		t.Errorf("couldn't buy a shield in round %d", c.round)
+	}
+}
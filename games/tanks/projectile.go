@@ -1,6 +1,8 @@
 package tanks
 
 import (
+	"math"
+
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
@@ -8,6 +10,16 @@ const gravity float64 = 500.0
 const radius float64 = 8.0
 const trailLength = 50
 
+const (
+	rollTime   = 4000.0 // ms a roller can roll for before going off
+	rollSpeed  = 150.0  // px per second
+	rollClimb  = 6.0    // px a roller can get up over
+	digTime    = 1200.0 // ms a digger tunnels for
+	digSpeed   = 220.0  // px per second
+	digRadius  = 12.0
+	mirvSpread = 90.0 // px per second between each warhead
+)
+
 type projectile struct {
 	x      float64
 	y      float64
@@ -18,6 +30,12 @@ type projectile struct {
 	radius float64
 	wv     float64
 	marker bool
+	weapon weapon
+	// rollers and diggers keep going once they hit the ground
+	rolling bool
+	rollDir float64
+	digging bool
+	timer   float64 // ms left rolling or digging
 }
 
 func NewProjectile(x, y float64, wind float64, marker bool) *projectile {
@@ -38,28 +56,118 @@ func NewProjectile(x, y float64, wind float64, marker bool) *projectile {
 	}
 }
 
-func (p *projectile) Update(delta float64) {
+// Update moves the projectile along however its weapon does.
+// Returns true once a roller or digger is done and should go off.
+func (p *projectile) Update(delta float64, tr *terrain) bool {
 	if p.marker {
-		return
+		return false
 	}
-	p.vx = p.vx + p.wv*delta/1000.0
-	p.vy = p.vy + gravity*delta/1000.0
-
 	p.prevXs = append(p.prevXs[1:], p.x)
 	p.prevYs = append(p.prevYs[1:], p.y)
+	if p.rolling {
+		return p.roll(delta, tr)
+	}
+	if p.digging {
+		return p.dig(delta, tr)
+	}
+
+	p.vx = p.vx + p.wv*delta/1000.0
+	p.vy = p.vy + gravity*delta/1000.0
 
 	p.x += p.vx * delta / 1000.0
 	p.y += p.vy * delta / 1000.0
+	return false
+}
+
+// hitGround checks a few points around the edge of the projectile
+func (p *projectile) hitGround(tr *terrain) bool {
+	for i := 0; i < 6; i++ {
+		cpx := p.x + p.radius*math.Cos(float64(i)*2.0/6.0*math.Pi)
+		cpy := p.y + p.radius*math.Sin(float64(i)*2.0/6.0*math.Pi)
+		if tr.isSolid(int(cpx), int(cpy)) {
+			return true
+		}
+	}
+	return false
+}
+
+// startRolling sets a roller off along the ground, downhill
+// if there's a downhill to go
+func (p *projectile) startRolling(tr *terrain) {
+	p.rolling = true
+	p.timer = rollTime
+	ground := tr.groundBelow(int(p.x), p.y-rollClimb)
+	p.y = ground - p.radius
+	left := tr.groundBelow(int(p.x-8), p.y)
+	right := tr.groundBelow(int(p.x+8), p.y)
+	p.rollDir = math.Copysign(1, p.vx)
+	if left != right {
+		p.rollDir = 1
+		if left > right {
+			p.rollDir = -1
+		}
+	}
+}
+
+func (p *projectile) roll(delta float64, tr *terrain) bool {
+	p.timer -= delta
+	nx := p.x + p.rollDir*rollSpeed*delta/1000
+	ground := tr.groundBelow(int(nx), p.y+p.radius-rollClimb)
+	// ran into something too steep to get over
+	if ground <= p.y+p.radius-rollClimb || p.timer <= 0 || nx < 0 || nx >= float64(tr.w) {
+		return true
+	}
+	// keep up with the ground but fall off cliffs under gravity
+	p.x = nx
+	if ground-p.radius > p.y+rollClimb {
+		p.vy += gravity * delta / 1000
+		p.y = math.Min(p.y+p.vy*delta/1000, ground-p.radius)
+	} else {
+		p.vy = 0
+		p.y = ground - p.radius
+	}
+	return false
+}
+
+func (p *projectile) startDigging() {
+	p.digging = true
+	p.timer = digTime
+	speed := math.Hypot(p.vx, p.vy)
+	if speed == 0 {
+		p.vx, p.vy, speed = 0, 1, 1
+	}
+	p.vx, p.vy = p.vx/speed*digSpeed, p.vy/speed*digSpeed
+}
 
+func (p *projectile) dig(delta float64, tr *terrain) bool {
+	p.timer -= delta
+	p.x += p.vx * delta / 1000
+	p.y += p.vy * delta / 1000
+	tr.carve(p.x, p.y, digRadius)
+	return p.timer <= 0 || p.x < 0 || p.x >= float64(tr.w) || p.y >= float64(tr.h)
+}
+
+// split breaks a mirv up into warheads spread out either side
+func (p *projectile) split() []*projectile {
+	warheads := []*projectile{}
+	for i := -2; i <= 2; i++ {
+		w := NewProjectile(p.x, p.y, p.wv, false)
+		w.weapon = weaponBomblet
+		w.radius = radius * 0.75
+		w.SetVelocity(p.vx+float64(i)*mirvSpread, p.vy)
+		warheads = append(warheads, w)
+	}
+	return warheads
 }
 
 func (p *projectile) Draw() {
+	c := weaponColors[p.weapon]
 	for i := 0; i < len(p.prevXs); i++ {
 		a := uint8(float32(i)/float32(len(p.prevXs)) * 255)
 		//a := uint8((1.0 - (1.0/float32(trailLength))*float32(len(p.prevXs)-i)) * 255)
-		rl.DrawCircle(int32(p.prevXs[i]), int32(p.prevYs[i]), float32(p.radius * float64(i)/float64(len(p.prevXs))), rl.Color{R: 0xff, G: 0x00, B: 0x00, A: a})
+		rl.DrawCircle(int32(p.prevXs[i]), int32(p.prevYs[i]), float32(p.radius * float64(i)/float64(len(p.prevXs))), rl.Color{R: c.R, G: c.G, B: c.B, A: a})
 	}
-	rl.DrawCircle(int32(p.x), int32(p.y), float32(p.radius), rl.Color{R: 0xff, G: 0x00, B: 0x00, A: 0xff})
+	rl.DrawCircle(int32(p.x), int32(p.y), float32(p.radius), c)
 }
 
 func (p *projectile) SetVelocity(x, y float64) {
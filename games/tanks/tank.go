@@ -1,16 +1,17 @@
 package tanks
 
 import (
-	"image"
 	"math"
-	"net/http"
 
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
-const tankSize = 48.0
+const (
+	tankSize  = 48.0
+	maxHealth = 100.0
+)
 
-var imgCache map[string]rl.Texture2D = make(map[string]rl.Texture2D)
 var refAngles = []float64{
 	0,
 	-math.Pi / 6,
@@ -30,11 +31,19 @@ type tank struct {
 	w                        float64
 	h                        float64
 	a                        float64
-	scale                    float64
 	projectileOffsetDistance float64
 	bounds                   bounds
-	img                      rl.Texture2D
+	avatar                   *imagecache.Image
 	lastShotAngle            float64
+	health                   float64
+	falling                  bool
+	fallStart                float64
+	vy                       float64
+	ammo                     map[weapon]int
+	skips                    int // turns missed in a row
+	shield                   float64
+	shieldBought             bool
+	ai                       *difficulty // nil for people
 }
 
 type bounds []edge
@@ -53,30 +62,19 @@ func (e edge) IsLeft(x, y float64) int {
 }
 
 func NewTank(playerName string, imgURL string) *tank {
-	scale := 1.0
-	var img rl.Texture2D
-	if cached, ok := imgCache[playerName]; ok {
-		img = cached
-	} else {
-		resp, err := http.Get(imgURL)
-		if err != nil {
-			img = rl.LoadTextureFromImage(rl.GenImageColor(tankSize, tankSize, rl.Blue))
-		} else {
-			raw, _, _ := image.Decode(resp.Body)
-			img = rl.LoadTextureFromImage(rl.NewImageFromImage(raw))
-			imgCache[playerName] = img
-		}
+	ammo := map[weapon]int{}
+	for w, n := range startingAmmo {
+		ammo[w] = n
 	}
 
-	scale = tankSize / float64(img.Width)
-
 	return &tank{
 		playerName:               playerName,
-		img:                      img,
-		w:                        scale * float64(img.Width),
-		h:                        scale * float64(img.Height),
+		avatar:                   imagecache.Get(imgURL),
+		w:                        tankSize,
+		h:                        tankSize,
 		projectileOffsetDistance: 50,
-		scale:                    scale,
+		health:                   maxHealth,
+		ammo:                     ammo,
 	}
 }
 
@@ -134,12 +132,25 @@ func (t *tank) Draw(myTurn bool) {
 		}
 	}
 
-	rl.DrawTextureEx(t.img, rl.Vector2{X: float32(t.x + xOffset), Y: float32(t.y + yOffset)}, float32(t.a*180/math.Pi), float32(t.scale), rl.White)
+	t.drawAvatar(rl.Rectangle{X: float32(t.x + xOffset), Y: float32(t.y + yOffset), Width: float32(t.w), Height: float32(t.h)}, t.a)
 	rl.DrawText(t.playerName, int32(t.x+t.w/2+10), int32(t.y-t.h), 24, textColor)
+	t.drawHealth()
 }
 
 
 func (t *tank) DrawTurn(p int32) {
-	rl.DrawTextureEx(t.img, rl.Vector2{X: 0, Y: float32(p*tankSize)}, 0, float32(t.scale), rl.White)
+	t.drawAvatar(rl.Rectangle{X: 0, Y: float32(p * tankSize), Width: tankSize, Height: tankSize}, 0)
 	rl.DrawText(t.playerName, int32(0+t.w/2+10), p*tankSize, 24, rl.Red)
 }
+
+// drawAvatar draws the players avatar, or a plain tank until
+// it's loaded, rotated about the top left corner
+func (t *tank) drawAvatar(dest rl.Rectangle, angle float64) {
+	if !t.avatar.Ready() {
+		rl.DrawRectanglePro(dest, rl.Vector2{}, float32(angle*180/math.Pi), []rl.Color{rl.Blue})
+		return
+	}
+	tex := t.avatar.Texture()
+	src := rl.Rectangle{X: 0, Y: 0, Width: float32(tex.Width), Height: float32(tex.Height)}
+	rl.DrawTexturePro(tex, src, dest, rl.Vector2{}, float32(angle*180/math.Pi), rl.White)
+}
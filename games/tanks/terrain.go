@@ -1,38 +1,164 @@
 package tanks
 
 import (
-	"math/rand"
-	"time"
+	"math"
 
 	rl "github.com/MattSwanson/raylib-go/raylib"
-	"github.com/ojrac/opensimplex-go"
 )
 
-const (
-	maxTerrainHeight = 1000 // measured from the bottom of the screen in pixels
-	smoothness       = 4    // lower = smoover - 4 is good balance
-)
+// terrain is a mask of which pixels are solid along with the
+// texture showing it. Changes are only sent to the gpu for the
+// area which changed.
+type terrain struct {
+	w      int
+	h      int
+	solid  []bool
+	pixels []rl.Color
+	tex    rl.Texture2D
+	style  string
+	seed   int64
+	theme  theme
+	water  float64 // y of the water line, h if there's no water
+	// area changed since the last upload
+	dirty                              bool
+	dirtyX0, dirtyY0, dirtyX1, dirtyY1 int
+}
+
+func newTerrain(w, h int) *terrain {
+	return &terrain{
+		w:      w,
+		h:      h,
+		solid:  make([]bool, w*h),
+		pixels: make([]rl.Color, w*h),
+		theme:  themes["hills"],
+		water:  float64(h),
+	}
+}
+
+// load makes the texture for the whole terrain, getting rid
+// of any it had before
+func (t *terrain) load() {
+	if t.tex.ID != 0 {
+		rl.UnloadTexture(t.tex)
+	}
+	img := rl.NewImage(make([]byte, t.w*t.h*4), int32(t.w), int32(t.h), 1, rl.UncompressedR8g8b8a8)
+	t.tex = rl.LoadTextureFromImage(img)
+	rl.UpdateTexture(t.tex, t.pixels)
+	t.dirty = false
+}
+
+func (t *terrain) unload() {
+	if t.tex.ID != 0 {
+		rl.UnloadTexture(t.tex)
+	}
+}
+
+// upload sends the changed part of the terrain to the gpu
+func (t *terrain) upload() {
+	if !t.dirty {
+		return
+	}
+	w, h := t.dirtyX1-t.dirtyX0, t.dirtyY1-t.dirtyY0
+	region := make([]rl.Color, 0, w*h)
+	for y := t.dirtyY0; y < t.dirtyY1; y++ {
+		region = append(region, t.pixels[y*t.w+t.dirtyX0:y*t.w+t.dirtyX1]...)
+	}
+	rl.UpdateTextureRec(t.tex, rl.Rectangle{X: float32(t.dirtyX0), Y: float32(t.dirtyY0), Width: float32(w), Height: float32(h)}, region)
+	t.dirty = false
+}
+
+func (t *terrain) markDirty(x0, y0, x1, y1 int) {
+	if !t.dirty {
+		t.dirtyX0, t.dirtyY0, t.dirtyX1, t.dirtyY1 = x0, y0, x1, y1
+		t.dirty = true
+		return
+	}
+	if x0 < t.dirtyX0 {
+		t.dirtyX0 = x0
+	}
+	if y0 < t.dirtyY0 {
+		t.dirtyY0 = y0
+	}
+	if x1 > t.dirtyX1 {
+		t.dirtyX1 = x1
+	}
+	if y1 > t.dirtyY1 {
+		t.dirtyY1 = y1
+	}
+}
 
-func generateTerrain(screenWidth, screenHeight int) (rl.Texture2D, []float64) {
-	rand.Seed(time.Now().UnixNano())
-	noise := opensimplex.NewNormalized(rand.Int63())
-	w, h := screenWidth, 1
-	heightmap := make([]float64, w*h)
-	for x := 0; x < w; x++ {
-		xFloat := float64(x) / float64(w)
-		heightmap[x] = noise.Eval2(xFloat*smoothness, 0)*maxTerrainHeight + float64(screenHeight) - maxTerrainHeight
-	}
-	imgW, imgH := screenWidth, screenHeight
-
-	pixels := make([]byte, imgW*imgH*4)
-	for x := 0; x < imgW; x++ {
-		for y := int(heightmap[x] - 100); y < imgH; y++ {
-			if float64(y) > heightmap[x] {
-				pixels[(y*4*imgW)+(x*4)+1] = 0x33
-				pixels[(y*4*imgW)+(x*4)+3] = 0xff
+func (t *terrain) set(x, y int, solid bool, color rl.Color) {
+	t.solid[y*t.w+x] = solid
+	t.pixels[y*t.w+x] = color
+}
+
+// underwater is true for anywhere below the water line which
+// isn't solid ground
+func (t *terrain) underwater(x, y float64) bool {
+	return y >= t.water && !t.isSolid(int(x), int(y))
+}
+
+func (t *terrain) isSolid(x, y int) bool {
+	if x < 0 || x >= t.w || y < 0 {
+		return false
+	}
+	if y >= t.h {
+		return true
+	}
+	return t.solid[y*t.w+x]
+}
+
+// surface gets the y of the highest solid ground in the column
+func (t *terrain) surface(x int) float64 {
+	return t.groundBelow(x, 0)
+}
+
+// groundBelow gets the y of the first solid ground at or below
+// y in the column, or the bottom of the screen if there is none
+func (t *terrain) groundBelow(x int, y float64) float64 {
+	if x < 0 {
+		x = 0
+	} else if x >= t.w {
+		x = t.w - 1
+	}
+	for yi := int(math.Max(0, y)); yi < t.h; yi++ {
+		if t.solid[yi*t.w+x] {
+			return float64(yi)
+		}
+	}
+	return float64(t.h)
+}
+
+// circle calls f for every pixel on screen within r of cx, cy
+func (t *terrain) circle(cx, cy, r float64, f func(x, y int)) {
+	x0, x1 := int(math.Max(0, cx-r)), int(math.Min(float64(t.w), cx+r+1))
+	y0, y1 := int(math.Max(0, cy-r)), int(math.Min(float64(t.h), cy+r+1))
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			if dx*dx+dy*dy <= r*r {
+				f(x, y)
 			}
 		}
 	}
-	img := rl.LoadTextureFromImage(rl.NewImage(pixels, int32(imgW), int32(imgH), 1, rl.UncompressedR8g8b8a8))
-	return img, heightmap
+	t.markDirty(x0, y0, x1, y1)
+}
+
+// carve blows a crater out of the terrain
+func (t *terrain) carve(cx, cy, r float64) {
+	t.circle(cx, cy, r, func(x, y int) {
+		t.set(x, y, false, rl.Blank)
+	})
+}
+
+// fill piles dirt up in a circle, leaving what's already there
+func (t *terrain) fill(cx, cy, r float64, color rl.Color) {
+	t.circle(cx, cy, r, func(x, y int) {
+		if !t.solid[y*t.w+x] {
+			t.set(x, y, true, color)
+		}
+	})
 }
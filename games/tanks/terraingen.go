@@ -0,0 +1,232 @@
+package tanks
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+	"github.com/ojrac/opensimplex-go"
+)
+
+const (
+	maxTerrainHeight = 1000 // measured from the bottom of the screen in pixels
+	smoothness       = 4    // lower = smoover - 4 is good balance
+	defaultStyle     = "hills"
+)
+
+// theme is how the terrain and the sky behind it are colored
+type theme struct {
+	surface rl.Color // the top of the ground
+	deep    rl.Color // what it fades to further down
+	depth   float64  // px down until it's all deep
+	skyTop  rl.Color
+	skyLow  rl.Color
+	water   rl.Color
+}
+
+var themes = map[string]theme{
+	"hills": {
+		surface: rl.Color{R: 0x00, G: 0x33, B: 0x00, A: 0xFF},
+		deep:    rl.Color{R: 0x00, G: 0x1A, B: 0x00, A: 0xFF},
+		depth:   300,
+		skyTop:  rl.Color{R: 0x10, G: 0x30, B: 0x60, A: 0x60},
+		skyLow:  rl.Color{R: 0x60, G: 0x90, B: 0xC0, A: 0x60},
+	},
+	"mountains": {
+		surface: rl.Color{R: 0xE0, G: 0xE0, B: 0xE8, A: 0xFF},
+		deep:    rl.Color{R: 0x40, G: 0x38, B: 0x34, A: 0xFF},
+		depth:   80,
+		skyTop:  rl.Color{R: 0x30, G: 0x40, B: 0x70, A: 0x60},
+		skyLow:  rl.Color{R: 0xB0, G: 0xC0, B: 0xD8, A: 0x60},
+	},
+	"islands": {
+		surface: rl.Color{R: 0xC2, G: 0xB2, B: 0x80, A: 0xFF},
+		deep:    rl.Color{R: 0x6B, G: 0x5A, B: 0x3A, A: 0xFF},
+		depth:   120,
+		skyTop:  rl.Color{R: 0x20, G: 0x80, B: 0xD0, A: 0x60},
+		skyLow:  rl.Color{R: 0xA0, G: 0xE0, B: 0xFF, A: 0x60},
+		water:   rl.Color{R: 0x10, G: 0x50, B: 0xA0, A: 0xB0},
+	},
+	"caves": {
+		surface: rl.Color{R: 0x55, G: 0x44, B: 0x33, A: 0xFF},
+		deep:    rl.Color{R: 0x22, G: 0x1A, B: 0x12, A: 0xFF},
+		depth:   60,
+		skyTop:  rl.Color{R: 0x05, G: 0x05, B: 0x10, A: 0x80},
+		skyLow:  rl.Color{R: 0x20, G: 0x18, B: 0x30, A: 0x80},
+	},
+}
+
+// generators fill in the solid mask of the terrain
+var generators = map[string]func(t *terrain, noise opensimplex.Noise){
+	"hills":     genHills,
+	"mountains": genMountains,
+	"islands":   genIslands,
+	"caves":     genCaves,
+}
+
+func terrainStyles() []string {
+	names := []string{}
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func generateTerrain(screenWidth, screenHeight int, style string, seed int64) *terrain {
+	gen, ok := generators[style]
+	if !ok {
+		style, gen = defaultStyle, generators[defaultStyle]
+	}
+	t := newTerrain(screenWidth, screenHeight)
+	t.style, t.seed, t.theme = style, seed, themes[style]
+	gen(t, opensimplex.NewNormalized(seed))
+	t.paint()
+	t.load()
+	return t
+}
+
+func randomSeed() int64 {
+	rand.Seed(time.Now().UnixNano())
+	return rand.Int63()
+}
+
+// fillBelow makes everything in the column from y down solid
+func (t *terrain) fillBelow(x int, y float64) {
+	for yi := int(math.Max(0, math.Ceil(y))); yi < t.h; yi++ {
+		t.solid[yi*t.w+x] = true
+	}
+}
+
+// genHills is gently rolling hills
+func genHills(t *terrain, noise opensimplex.Noise) {
+	for x := 0; x < t.w; x++ {
+		xFloat := float64(x) / float64(t.w)
+		t.fillBelow(x, noise.Eval2(xFloat*smoothness, 0)*maxTerrainHeight+float64(t.h)-maxTerrainHeight)
+	}
+}
+
+// genMountains is sharp ridges made from a few layers of noise
+func genMountains(t *terrain, noise opensimplex.Noise) {
+	const height = 1150.0
+	for x := 0; x < t.w; x++ {
+		xFloat := float64(x) / float64(t.w)
+		n, amp, freq, total := 0.0, 1.0, 3.0, 0.0
+		for octave := 0; octave < 4; octave++ {
+			// folding the noise over gives peaks rather than bumps
+			ridge := 1 - math.Abs(2*noise.Eval2(xFloat*freq, float64(octave)*10)-1)
+			n += ridge * ridge * amp
+			total += amp
+			amp /= 2
+			freq *= 2
+		}
+		t.fillBelow(x, float64(t.h)-n/total*height)
+	}
+}
+
+// genIslands is low land with water between, anything going in
+// the water is lost
+func genIslands(t *terrain, noise opensimplex.Noise) {
+	t.water = float64(t.h) - 350
+	for x := 0; x < t.w; x++ {
+		xFloat := float64(x) / float64(t.w)
+		n := noise.Eval2(xFloat*6, 0)
+		t.fillBelow(x, float64(t.h)-150-n*500)
+	}
+}
+
+// genCaves is ground full of holes, with overhangs and bits
+// floating in the air
+func genCaves(t *terrain, noise opensimplex.Noise) {
+	const scale = 300.0
+	for y := 0; y < t.h; y++ {
+		fy := float64(y) / float64(t.h)
+		for x := 0; x < t.w; x++ {
+			// more solid further down
+			density := noise.Eval2(float64(x)/scale, float64(y)/scale) + (fy-0.55)*1.6
+			if density > 0.5 || y >= t.h-40 {
+				t.solid[y*t.w+x] = true
+			}
+		}
+	}
+}
+
+// paint colors the solid ground, fading from the surface color at
+// the top of each bit of ground down to the deep color
+func (t *terrain) paint() {
+	for x := 0; x < t.w; x++ {
+		depth := 0.0
+		for y := 0; y < t.h; y++ {
+			i := y*t.w + x
+			if !t.solid[i] {
+				depth = 0
+				t.pixels[i] = rl.Blank
+				continue
+			}
+			t.pixels[i] = lerpColor(t.theme.surface, t.theme.deep, math.Min(1, depth/t.theme.depth))
+			depth++
+		}
+	}
+}
+
+func lerpColor(a, b rl.Color, f float64) rl.Color {
+	l := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f)
+	}
+	return rl.Color{R: l(a.R, b.R), G: l(a.G, b.G), B: l(a.B, b.B), A: l(a.A, b.A)}
+}
+
+func (t *terrain) drawSky() {
+	rl.DrawRectangleGradientV(0, 0, int32(t.w), int32(t.h), t.theme.skyTop, t.theme.skyLow)
+}
+
+func (t *terrain) drawWater() {
+	if t.water >= float64(t.h) {
+		return
+	}
+	rl.DrawRectangle(0, int32(t.water), int32(t.w), int32(float64(t.h)-t.water), t.theme.water)
+}
+
+// dryNear finds the closest x to the one given, between lo and hi,
+// which has ground above the water to sit on
+func (t *terrain) dryNear(x, lo, hi int) int {
+	for d := 0; x-d >= lo || x+d < hi; d++ {
+		for _, nx := range []int{x - d, x + d} {
+			if nx >= lo && nx < hi && t.surface(nx) < t.water {
+				return nx
+			}
+		}
+	}
+	return x
+}
+
+// !tanks terrain <name> [seed]
+func (c *Core) setTerrain(args []string) {
+	if len(args) < 2 || c.gameStarted {
+		return
+	}
+	style := strings.ToLower(args[1])
+	if _, ok := generators[style]; !ok {
+		events.Emit(events.New("tanks", "", "terrain_rejected").
+			With("styles", strings.Join(terrainStyles(), " ")))
+		return
+	}
+	seed := randomSeed()
+	if len(args) >= 3 {
+		s, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return
+		}
+		seed = s
+	}
+	c.terrain.unload()
+	c.terrain = generateTerrain(c.screenWidth, c.screenHeight, style, seed)
+	events.Emit(events.New("tanks", "", "terrain").
+		With("style", style).
+		With("seed", seed))
+}
@@ -0,0 +1,45 @@
+package tanks
+
+import (
+	"testing"
+
+	"github.com/ojrac/opensimplex-go"
+)
+
+func TestGenerators(t *testing.T) {
+	for _, style := range terrainStyles() {
+		tr := newTerrain(2560, 1440)
+		generators[style](tr, opensimplex.NewNormalized(42))
+
+		dry, overhangs := 0, 0
+		for x := 0; x < tr.w; x++ {
+			top := tr.surface(x)
+			if top >= float64(tr.h) {
+				t.Errorf("%s: no ground at all at x %d", style, x)
+				break
+			}
+			if top < tr.water {
+				dry++
+			}
+			// air under the top of the ground
+			for y := int(top); y < tr.h; y++ {
+				if !tr.isSolid(x, y) {
+					overhangs++
+					break
+				}
+			}
+		}
+		if dry < tr.w/10 {
+			t.Errorf("%s: only %d columns above water", style, dry)
+		}
+		if style == "islands" && dry == tr.w {
+			t.Errorf("islands: no water")
+		}
+		if style == "caves" && overhangs == 0 {
+			t.Errorf("caves: no overhangs")
+		}
+		if style != "caves" && overhangs != 0 {
+			t.Errorf("%s: %d columns with overhangs", style, overhangs)
+		}
+	}
+}
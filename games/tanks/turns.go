@@ -0,0 +1,128 @@
+package tanks
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	defaultTurnTime = 30.0 // seconds
+	defaultMaxSkips = 3
+	turnWarning     = 10.0 // seconds left when the timer goes red
+)
+
+// updateTurn starts the clock for whoever's turn it is and skips
+// them if it runs out. Returns true if the game is over.
+func (c *Core) updateTurn(delta float64) bool {
+	if !c.gameStarted || c.shotFired || len(c.turnOrder) == 0 {
+		return false
+	}
+	if c.turnOrder[0] != c.turnPlayer {
+		c.turnPlayer = c.turnOrder[0]
+		c.turnTimer = c.turnTime * 1000
+		c.aiThink = aiThinkTime
+		c.aiSearch = nil
+		if c.round == 0 || c.hadTurn[c.turnPlayer] {
+			c.newRound()
+		}
+		c.hadTurn[c.turnPlayer] = true
+		events.Emit(events.New("tanks", c.turnPlayer.playerName, "turn").
+			With("seconds", c.turnTime).
+			With("wind", fmt.Sprintf("%.2f", c.wind)).
+			With("bot", c.turnPlayer.ai != nil))
+	}
+	if c.turnPlayer.ai != nil {
+		c.updateAI(delta)
+		return false
+	}
+	c.turnTimer -= delta
+	if c.turnTimer > 0 {
+		return false
+	}
+	return c.skipTurn()
+}
+
+// newRound starts once everyone still in has had a turn, and lets
+// them all buy a shield again
+func (c *Core) newRound() {
+	c.round++
+	c.hadTurn = map[*tank]bool{}
+	for _, t := range c.tanks {
+		t.shieldBought = false
+	}
+	events.Emit(events.New("tanks", "", "round").With("round", c.round))
+}
+
+// skipTurn moves the current player to the back of the line and
+// takes them out of the game if they keep missing their turn
+func (c *Core) skipTurn() bool {
+	t := c.turnOrder[0]
+	t.skips++
+	events.Emit(events.New("tanks", t.playerName, "skipped").
+		With("skips", t.skips).
+		With("maxSkips", c.maxSkips))
+	if t.skips >= c.maxSkips {
+		events.Emit(events.New("tanks", t.playerName, "removed").
+			With("reason", "afk"))
+		return c.removePlayer(t)
+	}
+	c.turnOrder = rotateTurns(c.turnOrder)
+	return false
+}
+
+// leave lets a player drop out whenever they want
+func (c *Core) leave(player string) {
+	for _, t := range c.tanks {
+		if !strings.EqualFold(t.playerName, player) {
+			continue
+		}
+		events.Emit(events.New("tanks", t.playerName, "left"))
+		c.removePlayer(t)
+		if !c.gameStarted {
+			// close the gap in the line of waiting tanks
+			for i, w := range c.tanks {
+				w.setPosition(0+w.w/2, w.h*float64(i)+w.h)
+			}
+		}
+		return
+	}
+}
+
+// !tanks timer <seconds> [skips]
+func (c *Core) setTimer(args []string) {
+	if len(args) < 2 {
+		return
+	}
+	s, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || s <= 0 {
+		return
+	}
+	c.turnTime = s
+	if len(args) >= 3 {
+		if n, err := strconv.Atoi(args[2]); err == nil && n > 0 {
+			c.maxSkips = n
+		}
+	}
+	events.Emit(events.New("tanks", "", "timer").
+		With("seconds", c.turnTime).
+		With("maxSkips", c.maxSkips))
+}
+
+func (c *Core) drawTurnTimer() {
+	if !c.gameStarted || c.shotFired || c.turnPlayer == nil {
+		return
+	}
+	left := math.Max(0, c.turnTimer/1000)
+	color := rl.Green
+	if left <= turnWarning {
+		color = rl.Red
+	}
+	w := float64(c.screenWidth-150) * left / c.turnTime
+	rl.DrawRectangle(75, 1410, int32(w), 12, color)
+	rl.DrawText(fmt.Sprintf("%.0fs", math.Ceil(left)), 75, 1250, 48, color)
+}
@@ -0,0 +1,279 @@
+package tanks
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/MattSwanson/burtbot_overlay/sound"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	clusterBomblets = 5
+	clusterSpeed    = 250.0 // px per second the bomblets are thrown out at
+	dirtRadius      = 60.0
+	napalmFires     = 20
+	fireTime        = 4000.0 // ms
+	fireRadius      = 6.0
+	fireFlow        = 40.0 // px per second napalm runs downhill
+	fireDamage      = 15.0 // health per second for a tank in the fire
+)
+
+type weapon int
+
+const (
+	weaponShell weapon = iota
+	weaponCluster
+	weaponMIRV
+	weaponRoller
+	weaponDirt
+	weaponDigger
+	weaponNapalm
+	// what clusters and mirvs break up into
+	weaponBomblet
+)
+
+// the order weapons are listed in on the hud
+var weaponOrder = []weapon{weaponShell, weaponCluster, weaponMIRV, weaponRoller, weaponDirt, weaponDigger, weaponNapalm}
+
+var weaponNames = map[weapon]string{
+	weaponShell:   "shell",
+	weaponCluster: "cluster",
+	weaponMIRV:    "mirv",
+	weaponRoller:  "roller",
+	weaponDirt:    "dirt",
+	weaponDigger:  "digger",
+	weaponNapalm:  "napalm",
+	weaponBomblet: "bomblet",
+}
+
+// what each player gets at the start of a game, shells are unlimited
+var startingAmmo = map[weapon]int{
+	weaponCluster: 2,
+	weaponMIRV:    1,
+	weaponRoller:  2,
+	weaponDirt:    2,
+	weaponDigger:  2,
+	weaponNapalm:  1,
+}
+
+var blastRadius = map[weapon]float64{
+	weaponShell:   craterRadius,
+	weaponCluster: 30,
+	weaponMIRV:    craterRadius,
+	weaponRoller:  45,
+	weaponDigger:  20,
+	weaponNapalm:  15,
+	weaponBomblet: 25,
+}
+
+var weaponColors = map[weapon]rl.Color{
+	weaponShell:   rl.White,
+	weaponCluster: rl.Yellow,
+	weaponMIRV:    rl.Red,
+	weaponRoller:  rl.LightGray,
+	weaponDirt:    rl.Brown,
+	weaponDigger:  rl.Gray,
+	weaponNapalm:  rl.Orange,
+	weaponBomblet: rl.Gold,
+}
+
+func (w weapon) String() string {
+	return weaponNames[w]
+}
+
+func parseWeapon(s string) (weapon, bool) {
+	for _, w := range weaponOrder {
+		if strings.EqualFold(weaponNames[w], s) {
+			return w, true
+		}
+	}
+	return weaponShell, false
+}
+
+// fire is a bit of burning napalm
+type fire struct {
+	x    float64
+	y    float64
+	life float64 // ms left burning
+}
+
+// inventory is what the tank has left, for the hud
+func (t *tank) inventory() string {
+	s := []string{}
+	for _, w := range weaponOrder {
+		if w == weaponShell {
+			s = append(s, "shell ∞")
+			continue
+		}
+		s = append(s, fmt.Sprintf("%s %d", w, t.ammo[w]))
+	}
+	return strings.Join(s, " | ")
+}
+
+// updateProjectiles moves everything in the air along, setting it
+// off when it hits something. Returns true if the game is over.
+func (c *Core) updateProjectiles(delta float64) bool {
+	for _, p := range append([]*projectile{}, c.projectiles...) {
+		if p.weapon == weaponMIRV && !p.rolling && p.vy > 0 {
+			// past the top of the arc
+			c.removeProjectile(p)
+			c.projectiles = append(c.projectiles, p.split()...)
+			continue
+		}
+
+		if t := c.hitTank(p); t != nil {
+			c.removeProjectile(p)
+			c.boom(t.cx, t.cy)
+			if c.detonate(p) {
+				return true
+			}
+			continue
+		}
+
+		//check for oob
+		if p.x < -100 || p.x > float64(c.screenWidth)+100 || p.y > float64(c.screenHeight) || p.y < -2000 {
+			c.removeProjectile(p)
+			continue
+		}
+
+		if c.terrain.underwater(p.x, p.y) {
+			// gone without a bang
+			sound.Play("kerplunk")
+			c.removeProjectile(p)
+			continue
+		}
+
+		if !p.rolling && !p.digging && p.hitGround(c.terrain) {
+			// thunk
+			sound.Play("kerplunk")
+			switch p.weapon {
+			case weaponRoller:
+				p.startRolling(c.terrain)
+			case weaponDigger:
+				p.startDigging()
+			default:
+				c.removeProjectile(p)
+				if c.detonate(p) {
+					return true
+				}
+			}
+			continue
+		}
+
+		if p.Update(delta, c.terrain) {
+			c.removeProjectile(p)
+			if c.detonate(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hitTank gets the tank the projectile is touching, if any
+func (c *Core) hitTank(p *projectile) *tank {
+	for _, tank := range c.tanks {
+		maxDist := math.Sqrt(tank.w*tank.w+tank.h*tank.h) + p.radius
+		dst := math.Sqrt((tank.cx-p.x)*(tank.cx-p.x) + (tank.cy-p.y)*(tank.cy-p.y))
+		if dst > maxDist {
+			continue
+		}
+
+		for i := 0; i < 32; i++ {
+			cpx := p.x + p.radius*math.Cos(float64(i)*2.0/32.0*math.Pi)
+			cpy := p.y - p.radius*math.Sin(float64(i)*2.0/32.0*math.Pi)
+			if tank.bounds[0].IsLeft(cpx, cpy) > 0 && tank.bounds[1].IsLeft(cpx, cpy) > 0 && tank.bounds[2].IsLeft(cpx, cpy) > 0 && tank.bounds[3].IsLeft(cpx, cpy) > 0 {
+				return tank
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Core) removeProjectile(p *projectile) {
+	for i, o := range c.projectiles {
+		if o == p {
+			c.projectiles = append(c.projectiles[:i], c.projectiles[i+1:]...)
+			return
+		}
+	}
+}
+
+// detonate sets the projectile off where it is. Returns true if
+// the blast finished the game.
+func (c *Core) detonate(p *projectile) bool {
+	switch p.weapon {
+	case weaponDirt:
+		c.terrain.fill(p.x, p.y, dirtRadius, c.terrain.theme.surface)
+		return false
+	case weaponCluster:
+		for i := 0; i < clusterBomblets; i++ {
+			// fanned out upwards
+			a := math.Pi/6 + float64(i)*(2*math.Pi/3)/float64(clusterBomblets-1)
+			b := NewProjectile(p.x, p.y-blastRadius[p.weapon], p.wv, false)
+			b.weapon = weaponBomblet
+			b.radius = radius * 0.75
+			b.SetVelocity(math.Cos(a)*clusterSpeed, -math.Sin(a)*clusterSpeed)
+			c.projectiles = append(c.projectiles, b)
+		}
+	case weaponNapalm:
+		for i := 0; i < napalmFires; i++ {
+			x := p.x + (rand.Float64()-0.5)*4*blastRadius[p.weapon]
+			c.fires = append(c.fires, &fire{
+				x:    x,
+				y:    c.terrain.groundBelow(int(x), p.y-blastRadius[p.weapon]),
+				life: fireTime * (0.75 + rand.Float64()/4),
+			})
+		}
+	}
+	c.terrain.carve(p.x, p.y, blastRadius[p.weapon])
+	return c.splash(p.x, p.y, p.weapon)
+}
+
+// updateFires runs napalm downhill and burns any tank sitting in
+// it. Returns true if the game is over.
+func (c *Core) updateFires(delta float64) bool {
+	dt := delta / 1000
+	fires := []*fire{}
+	for _, f := range c.fires {
+		f.life -= delta
+		if f.life <= 0 || f.y >= c.terrain.water {
+			continue
+		}
+		fires = append(fires, f)
+		// run towards whichever side is lower
+		left := c.terrain.groundBelow(int(f.x-2), f.y-rollClimb)
+		right := c.terrain.groundBelow(int(f.x+2), f.y-rollClimb)
+		if left > f.y && left > right {
+			f.x -= fireFlow * dt
+		} else if right > f.y {
+			f.x += fireFlow * dt
+		}
+		f.y = c.terrain.groundBelow(int(f.x), f.y-rollClimb)
+	}
+	c.fires = fires
+
+	for _, t := range append([]*tank{}, c.tanks...) {
+		for _, f := range c.fires {
+			if math.Hypot(t.cx-f.x, t.cy-f.y) > t.w/2+fireRadius {
+				continue
+			}
+			if c.damage(t, fireDamage*dt, c.shooterName, weaponNapalm.String()) {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+func (c *Core) drawFires() {
+	for _, f := range c.fires {
+		a := uint8(math.Min(1, f.life/1000) * 255)
+		r := float32(fireRadius * (0.8 + 0.4*rand.Float64()))
+		rl.DrawCircle(int32(f.x), int32(f.y-fireRadius), r, rl.Color{R: 0xFF, G: uint8(0x40 + rand.Intn(0x80)), B: 0x00, A: a})
+	}
+}
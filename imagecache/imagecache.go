@@ -0,0 +1,304 @@
+// Package imagecache loads images from the web without holding up
+// the render loop. Images are fetched and decoded in the background,
+// kept on disk for next time and only uploaded to the gpu from the
+// main thread. Anything still loading draws as a placeholder.
+// Images which haven't been drawn for a while are taken off the
+// gpu and loaded again if they're wanted, and ones which failed
+// are tried again after a while.
+package imagecache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	maxAge          = 7 * 24 * time.Hour // before it's fetched again
+	uploadsPerFrame = 8
+	placeholderSize = 64
+	defaultDelay    = 7                // 100ths of a second, for gifs which don't say
+	unusedTime      = 5 * time.Minute  // before an image nobody's drawn is unloaded
+	retryTime       = time.Minute      // before a failed image is tried again
+	sweepTime       = 10 * time.Second // between looks for unused images
+)
+
+// Image is an image from the web which may not have loaded yet.
+// Everything besides Get should only be used from the main thread.
+type Image struct {
+	url      string
+	tex      rl.Texture2D
+	frames   int
+	delay    []int
+	ready    bool
+	failed   bool
+	failedAt time.Time
+	evicted  bool // unloaded, and out of the cache until it's used again
+	used     time.Time
+}
+
+// decoded is an image ready to go to the gpu. Animated gifs are
+// laid out as a strip of frames left to right.
+type decoded struct {
+	img    *Image
+	pixels []byte
+	w      int
+	h      int
+	frames int
+	delay  []int
+	err    error
+}
+
+var (
+	cacheDir    = "./image_cache"
+	lock        sync.Mutex
+	cache       = map[string]*Image{}
+	uploads     = make(chan decoded, 64)
+	client      = &http.Client{Timeout: 10 * time.Second}
+	placeholder *rl.Texture2D
+	lastSweep   time.Time
+)
+
+// Get starts loading the image at url, unless it's been asked for
+// before. Safe to call from anywhere.
+func Get(url string) *Image {
+	lock.Lock()
+	defer lock.Unlock()
+	if img, ok := cache[url]; ok {
+		return img
+	}
+	img := &Image{url: url, frames: 1}
+	cache[url] = img
+	img.load()
+	return img
+}
+
+// load fetches and decodes the image in the background, ready
+// for Upload
+func (i *Image) load() {
+	go func() {
+		d := decoded{img: i}
+		if i.url == "" {
+			d.err = fmt.Errorf("no url")
+		} else if data, err := fetch(i.url); err != nil {
+			d.err = err
+		} else {
+			d = decode(i, data)
+		}
+		uploads <- d
+	}()
+}
+
+// touch notes the image is still wanted, and loads it again if it
+// was unloaded or failed long enough ago
+func (i *Image) touch() {
+	i.used = time.Now()
+	if !i.evicted && !(i.failed && time.Since(i.failedAt) > retryTime) {
+		return
+	}
+	i.evicted, i.failed = false, false
+	lock.Lock()
+	if _, ok := cache[i.url]; !ok {
+		cache[i.url] = i
+	}
+	lock.Unlock()
+	i.load()
+}
+
+// Upload moves a few of the images which have finished loading
+// onto the gpu, and every so often unloads the ones nobody's
+// drawn lately. Call it once a frame from the main thread.
+func Upload() {
+	if time.Since(lastSweep) > sweepTime {
+		lastSweep = time.Now()
+		for _, img := range unused(lastSweep) {
+			rl.UnloadTexture(img.tex)
+			img.tex = rl.Texture2D{}
+		}
+	}
+	for i := 0; i < uploadsPerFrame; i++ {
+		select {
+		case d := <-uploads:
+			if d.err != nil {
+				log.Println("couldn't load image", d.err.Error())
+				d.img.failed = true
+				d.img.failedAt = time.Now()
+				continue
+			}
+			img := rl.NewImage(d.pixels, int32(d.w), int32(d.h), 1, rl.UncompressedR8g8b8a8)
+			d.img.tex = rl.LoadTextureFromImage(img)
+			d.img.frames = d.frames
+			d.img.delay = d.delay
+			d.img.ready = true
+			d.img.used = time.Now()
+		default:
+			return
+		}
+	}
+}
+
+// unused takes images nobody's drawn since unusedTime before now
+// out of the cache, and gets the ones which need unloading from
+// the gpu. Failed ones are just forgotten.
+func unused(now time.Time) []*Image {
+	lock.Lock()
+	defer lock.Unlock()
+	unload := []*Image{}
+	for url, img := range cache {
+		if (!img.ready && !img.failed) || now.Sub(img.used) < unusedTime {
+			continue
+		}
+		delete(cache, url)
+		if img.ready {
+			img.ready = false
+			img.evicted = true
+			unload = append(unload, img)
+		}
+	}
+	return unload
+}
+
+// Ready is true once the image is on the gpu
+func (i *Image) Ready() bool {
+	i.touch()
+	return i.ready
+}
+
+// Failed is true if the image couldn't be loaded. It's tried
+// again once it's used after retryTime.
+func (i *Image) Failed() bool {
+	return i.failed
+}
+
+// Texture gets the image, or the placeholder if it isn't ready
+func (i *Image) Texture() rl.Texture2D {
+	i.touch()
+	if i.ready {
+		return i.tex
+	}
+	if placeholder == nil {
+		tex := rl.LoadTextureFromImage(rl.GenImageColor(placeholderSize, placeholderSize, rl.Gray))
+		placeholder = &tex
+	}
+	return *placeholder
+}
+
+// Frames is how many frames there are in the texture, side by side
+func (i *Image) Frames() int {
+	return i.frames
+}
+
+// Delay is how long to show each frame for, in 100ths of a second
+func (i *Image) Delay() []int {
+	return i.delay
+}
+
+// FrameWidth is the width of one frame of the texture
+func (i *Image) FrameWidth() int {
+	return int(i.Texture().Width) / i.frames
+}
+
+func cachePath(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// fetch gets the image from disk if it's been fetched recently,
+// from the web if not, and from disk anyway if the web fails
+func fetch(url string) ([]byte, error) {
+	path := cachePath(url)
+	info, statErr := os.Stat(path)
+	if statErr == nil && time.Since(info.ModTime()) < maxAge {
+		return os.ReadFile(path)
+	}
+	data, err := download(url)
+	if err != nil {
+		if statErr == nil {
+			return os.ReadFile(path)
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		log.Println("couldn't make image cache", err.Error())
+	} else if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Println("couldn't cache image", err.Error())
+	}
+	return data, nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %d for %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func decode(img *Image, data []byte) decoded {
+	d := decoded{img: img, frames: 1}
+	if http.DetectContentType(data) == "image/gif" {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			d.err = err
+			return d
+		}
+		if len(g.Image) > 1 {
+			return decodeGIF(img, g)
+		}
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		d.err = err
+		return d
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	d.pixels, d.w, d.h = rgba.Pix, b.Dx(), b.Dy()
+	return d
+}
+
+// decodeGIF lays each frame out side by side, drawn over the
+// ones before it
+func decodeGIF(img *Image, g *gif.GIF) decoded {
+	w, h := g.Config.Width, g.Config.Height
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	strip := image.NewRGBA(image.Rect(0, 0, w*len(g.Image), h))
+	delay := make([]int, len(g.Image))
+	noDelay := true
+	for i, frame := range g.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		draw.Draw(strip, image.Rect(i*w, 0, (i+1)*w, h), canvas, image.Point{}, draw.Src)
+		if i < len(g.Delay) {
+			delay[i] = g.Delay[i]
+		}
+		if delay[i] != 0 {
+			noDelay = false
+		}
+	}
+	if noDelay {
+		for i := range delay {
+			delay[i] = defaultDelay
+		}
+	}
+	return decoded{img: img, pixels: strip.Pix, w: strip.Rect.Dx(), h: h, frames: len(g.Image), delay: delay}
+}
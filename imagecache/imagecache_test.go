@@ -0,0 +1,141 @@
+package imagecache
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDecodeGIFStrip(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.RGBA{R: 0xFF, A: 0xFF}}
+	g := &gif.GIF{Delay: []int{0, 0, 0}}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 2), pal)
+		frame.SetColorIndex(i, 0, 1)
+		g.Image = append(g.Image, frame)
+	}
+	buf := bytes.Buffer{}
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	d := decode(&Image{}, buf.Bytes())
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	if d.frames != 3 || d.w != 12 || d.h != 2 {
+		t.Fatalf("got %d frames %dx%d, want 3 frames 12x2", d.frames, d.w, d.h)
+	}
+	for _, delay := range d.delay {
+		if delay != defaultDelay {
+			t.Errorf("got delay %d, want %d", delay, defaultDelay)
+		}
+	}
+	// frames are drawn over the ones before, so the last frame
+	// has all three pixels set
+	for x := 0; x < 3; x++ {
+		if a := d.pixels[(2*4+x)*4+3]; a != 0xFF {
+			t.Errorf("pixel %d of the last frame has alpha %d", x, a)
+		}
+	}
+}
+
+func TestFetchUsesDiskCache(t *testing.T) {
+	cacheDir = t.TempDir()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	}))
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := fetch(srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("fetched %d times, want 1", requests)
+	}
+
+	// once it's too old it's fetched again
+	old := time.Now().Add(-maxAge - time.Hour)
+	if err := os.Chtimes(cachePath(srv.URL), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetch(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("fetched %d times, want 2", requests)
+	}
+
+	// and the old copy is used if the server has gone
+	srv.Close()
+	if err := os.Chtimes(cachePath(srv.URL), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetch(srv.URL); err != nil {
+		t.Fatalf("didn't fall back to the cached copy: %v", err)
+	}
+}
+
+func TestUnusedImagesEvicted(t *testing.T) {
+	now := time.Now()
+	fresh := &Image{url: "fresh", ready: true, used: now}
+	stale := &Image{url: "stale", ready: true, used: now.Add(-unusedTime - time.Second)}
+	failed := &Image{url: "failed", failed: true, used: now.Add(-unusedTime - time.Second)}
+	loading := &Image{url: "loading"}
+	cache = map[string]*Image{"fresh": fresh, "stale": stale, "failed": failed, "loading": loading}
+
+	unload := unused(now)
+	if len(unload) != 1 || unload[0] != stale {
+		t.Fatalf("got %d to unload, want just the stale one", len(unload))
+	}
+	if stale.ready || !stale.evicted {
+		t.Error("stale image is still marked ready")
+	}
+	for _, url := range []string{"fresh", "loading"} {
+		if cache[url] == nil {
+			t.Errorf("%s image was taken out of the cache", url)
+		}
+	}
+	for _, url := range []string{"stale", "failed"} {
+		if cache[url] != nil {
+			t.Errorf("%s image is still in the cache", url)
+		}
+	}
+
+	// using it again puts it back and loads it
+	stale.url = ""
+	stale.touch()
+	if cache[""] != stale || stale.evicted {
+		t.Fatal("evicted image wasn't loaded again")
+	}
+	if d := <-uploads; d.img != stale {
+		t.Fatal("got an upload for another image")
+	}
+}
+
+func TestFailedImagesRetry(t *testing.T) {
+	cache = map[string]*Image{}
+	img := &Image{url: "", failed: true, failedAt: time.Now()}
+	img.touch()
+	if !img.failed {
+		t.Fatal("retried before retryTime")
+	}
+	img.failedAt = time.Now().Add(-retryTime - time.Second)
+	img.touch()
+	if img.failed {
+		t.Fatal("didn't retry after retryTime")
+	}
+	if d := <-uploads; d.img != img || d.err == nil {
+		t.Fatal("retry didn't load the image")
+	}
+}
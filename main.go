@@ -21,8 +21,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	"github.com/MattSwanson/burtbot_overlay/games"
 	"github.com/MattSwanson/burtbot_overlay/games/cube"
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
 	"github.com/MattSwanson/burtbot_overlay/planes"
 	"github.com/MattSwanson/burtbot_overlay/shaders"
 	"github.com/MattSwanson/burtbot_overlay/sound"
@@ -200,6 +202,7 @@ const (
 	SteamCmd
 	GameCmd
 	FlashLightCmd
+	LeaderboardCmd
 
 	screenWidth  = 2560
 	screenHeight = 1440
@@ -285,6 +288,10 @@ func (g *Game) Update() {
 		case SnakeCmd:
 			if key.args[0] == "start" && !g.gameRunning {
 				g.snakeGame.reset()
+				g.snakeGame.player = "chat"
+				if len(key.args) > 1 {
+					g.snakeGame.player = key.args[1]
+				}
 				g.gameRunning = true
 			} else if key.args[0] == "stop" {
 				g.gameRunning = false
@@ -409,6 +416,8 @@ func (g *Game) Update() {
 			visuals.NewSteam().GetRandomGame()
 		case GameCmd:
 			games.HandleMessage(key.args)
+		case LeaderboardCmd:
+			visuals.HandleLeaderboardMessage(key.args)
 		}
 	default:
 	}
@@ -416,12 +425,14 @@ func (g *Game) Update() {
 		g.snakeGame.Update(g.currentInput)
 		g.currentInput = 0
 	}
+	imagecache.Upload()
 	games.Update(delta)
 	if g.showStatic {
 		g.staticLayer.Update()
 	}
 	g.bopometer.Update(delta)
 	visuals.UpdateMarquees(delta)
+	visuals.UpdateLeaderboard(delta)
 	if g.showDM {
 		visuals.UpdateDMarquee(delta)
 	}
@@ -512,6 +523,8 @@ func (g *Game) Draw() {
 
 	visuals.DrawMetrics()
 
+	visuals.DrawLeaderboard()
+
 	if nowPlaying != "" {
 		rl.DrawRectangle(0, npBGY, 2560, 75, rl.Color{R: 0, G: 0, B: 0, A: 192})
 		rl.DrawTextEx(ibmFont, fmt.Sprintf("Now Playing: %s", nowPlaying), rl.Vector2{X: 25, Y: npTextY}, 48, 0, rl.SkyBlue)
@@ -558,8 +571,11 @@ func main() {
 	visuals.LoadDropsAssets()
 	//visuals.LoadFSAssets()
 	visuals.InitMetrics()
+	visuals.LoadLeaderboard()
+	defer visuals.SaveLeaderboard()
 	ga.commChannel = make(chan cmd)
 	ga.connWriteChan = make(chan string)
+	events.Load(ga.connWriteChan)
 	game := &ga
 	game.bigMouseImg = sprites[2]
 	visuals.LoadMarqueeFonts()
@@ -596,11 +612,11 @@ func main() {
 			go handleConnection(conn, c, wc)
 		}
 	}(game.commChannel, ga.connWriteChan)
-	games.Load(screenWidth, screenHeight, game.connWriteChan)
+	games.Load(screenWidth, screenHeight)
 	defer games.Cleanup()
 	game.snakeGame = newSnake()
-	cube.LoadCubeAssets(game.connWriteChan)
-	game.bopometer = visuals.NewBopometer(game.connWriteChan)
+	cube.LoadCubeAssets()
+	game.bopometer = visuals.NewBopometer()
 	game.bingoOverlay = visuals.NewBingoOverlay()
 	game.errorManager = visuals.NewErrorManager()
 	/*if err := visuals.PollFS(); err != nil {
@@ -854,6 +870,16 @@ func parseCommandFromString(s string) (cmd, error) {
 		return cmd{SteamCmd, []string{}}, nil
 	case "slots":
 		return cmd{GameCmd, fields}, nil
+	case "game":
+		if len(fields) < 2 {
+			return cmdErr(fields[0], CmdErrNotEnoughArgs)
+		}
+		return cmd{GameCmd, fields}, nil
+	case "leaderboard":
+		if len(fields) < 2 {
+			return cmdErr(fields[0], CmdErrNotEnoughArgs)
+		}
+		return cmd{LeaderboardCmd, fields[1:]}, nil
 	}
 	return cmdErr("Handler", CmdErrInvalidCommand)
 }
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	"github.com/MattSwanson/burtbot_overlay/sound"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
@@ -39,6 +40,7 @@ type Snake struct {
 	score         int
 	bestScore     int
 	level         int
+	player        string
 }
 
 func init() {
@@ -120,6 +122,9 @@ func (s *Snake) Update(currentInput int) error {
 
 		if s.collidesWithSelf() {
 			sound.Play("zap")
+			events.Emit(events.New("snake", s.player, "gameover").
+				With("score", s.score).
+				With("level", s.level))
 			s.reset()
 		}
 
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/events"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
@@ -31,7 +32,6 @@ type Bopometer struct {
 	finished      bool
 	bops          []*bop
 	bopIndicatorY float32
-	writeChannel  chan string
 }
 
 func LoadBopometerAssets() {
@@ -45,9 +45,9 @@ func LoadBopometerAssets() {
 	rl.SetTextureFilter(bopFont.Texture, rl.FilterAnisotropic16x)
 }
 
-func NewBopometer(wc chan string) *Bopometer {
+func NewBopometer() *Bopometer {
 	finalLabelX = int(rl.MeasureTextEx(bopFont, finalLabel, textSize, 0).X / 2)
-	return &Bopometer{bops: []*bop{}, writeChannel: wc}
+	return &Bopometer{bops: []*bop{}}
 }
 
 func (b *Bopometer) Draw() {
@@ -138,7 +138,9 @@ func (b *Bopometer) IsRunning() bool    { return b.running }
 func (b *Bopometer) IsFinished() bool   { return b.finished }
 func (b *Bopometer) Reset()             { b.currentRating = 0; b.bops = []*bop{}; b.totalBops = 0 }
 func (b *Bopometer) Finish() {
-	b.writeChannel <- fmt.Sprintf("bop result %.2f\n", b.currentRating)
+	events.Emit(events.New("bop", "", "rating").
+		With("rating", fmt.Sprintf("%.2f", b.currentRating)).
+		With("bops", b.totalBops))
 	b.finished = true
 	go func() {
 		time.Sleep(time.Second * 10)
@@ -0,0 +1,360 @@
+package visuals
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MattSwanson/burtbot_overlay/events"
+	rl "github.com/MattSwanson/raylib-go/raylib"
+)
+
+const (
+	leaderboardPath     = "./leaderboard.json"
+	leaderboardTextSize = 56
+	leaderboardRows     = 10
+	leaderboardWidth    = 900
+	leaderboardRowH     = 70
+	leaderboardX        = screenWidth - leaderboardWidth - 50
+	leaderboardY        = 200
+	leaderboardShowTime = 15.0  // seconds
+	leaderboardSlide    = 600.0 // ms to slide in or out
+	leaderboardRowDelay = 120.0 // ms between each row appearing
+	leaderboardSaveTime = 10 * time.Second
+	dayKeyFormat        = "2006-01-02"
+)
+
+type playerStats struct {
+	Plays     int      `json:"plays"`
+	Wins      int      `json:"wins"`
+	Payout    *big.Int `json:"payout"`
+	Kills     int      `json:"kills"`
+	Moves     int      `json:"moves"`
+	HighScore int      `json:"highScore"`
+}
+
+func (s *playerStats) add(o *playerStats) {
+	s.Plays += o.Plays
+	s.Wins += o.Wins
+	s.Payout.Add(s.Payout, o.Payout)
+	s.Kills += o.Kills
+	s.Moves += o.Moves
+	if o.HighScore > s.HighScore {
+		s.HighScore = o.HighScore
+	}
+}
+
+// game -> day -> player
+type statsStore map[string]map[string]map[string]*playerStats
+
+type leaderboardRow struct {
+	player string
+	value  string
+}
+
+var (
+	stats            statsStore = statsStore{}
+	statsLock        sync.Mutex
+	leaderboardFont  rl.Font
+	leaderboardTitle string
+	leaderboardData  []leaderboardRow
+	leaderboardShown bool
+	leaderboardTime  float64 // ms since shown
+	statsDirty       bool    // changed since the last save
+)
+
+var leaderboardPeriods = map[string]int{
+	"day":   1,
+	"week":  7,
+	"month": 30,
+}
+
+// LoadLeaderboard reads saved stats from disk and starts
+// recording results from game events
+func LoadLeaderboard() {
+	leaderboardFont = rl.LoadFontEx("caskaydia.TTF", leaderboardTextSize, nil)
+	bs, err := os.ReadFile(leaderboardPath)
+	if err == nil {
+		if err := json.Unmarshal(bs, &stats); err != nil {
+			log.Println("couldn't parse leaderboard stats", err.Error())
+			stats = statsStore{}
+		}
+	}
+	events.Subscribe(recordEvent)
+	go func() {
+		for range time.Tick(leaderboardSaveTime) {
+			SaveLeaderboard()
+		}
+	}()
+}
+
+func recordEvent(e events.Event) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	switch e.Game {
+	case "plinko", "slots":
+		if e.Outcome != "win" && e.Outcome != "loss" {
+			return
+		}
+		s := getStats(e.Game, e.Player, e.Timestamp)
+		s.Plays++
+		if e.Outcome == "win" {
+			s.Wins++
+		}
+		if e.Payout != nil {
+			s.Payout.Add(s.Payout, e.Payout)
+		}
+	case "tanks":
+		switch e.Outcome {
+		case "eliminated":
+			getStats(e.Game, e.Player, e.Timestamp).Plays++
+			if by := e.Metadata["by"]; by != "" && by != e.Player {
+				getStats(e.Game, by, e.Timestamp).Kills++
+			}
+		case "winner":
+			s := getStats(e.Game, e.Player, e.Timestamp)
+			s.Plays++
+			s.Wins++
+		default:
+			return
+		}
+	case "cube":
+		if e.Outcome != "move" || e.Player == "" {
+			return
+		}
+		getStats(e.Game, e.Player, e.Timestamp).Moves++
+	case "snake":
+		if e.Outcome != "gameover" {
+			return
+		}
+		s := getStats(e.Game, e.Player, e.Timestamp)
+		s.Plays++
+		var score int
+		fmt.Sscan(e.Metadata["score"], &score)
+		if score > s.HighScore {
+			s.HighScore = score
+		}
+	default:
+		return
+	}
+	statsDirty = true
+}
+
+// getStats should be called with the stats lock held
+func getStats(game, player string, t time.Time) *playerStats {
+	day := t.Format(dayKeyFormat)
+	if _, ok := stats[game]; !ok {
+		stats[game] = map[string]map[string]*playerStats{}
+	}
+	if _, ok := stats[game][day]; !ok {
+		stats[game][day] = map[string]*playerStats{}
+	}
+	s, ok := stats[game][day][player]
+	if !ok {
+		s = &playerStats{Payout: big.NewInt(0)}
+		stats[game][day][player] = s
+	}
+	if s.Payout == nil {
+		s.Payout = big.NewInt(0)
+	}
+	return s
+}
+
+// SaveLeaderboard writes the stats to disk if anything's changed
+// since they were last saved. Events come in too often to save
+// on each one so this runs every leaderboardSaveTime.
+func SaveLeaderboard() {
+	statsLock.Lock()
+	if !statsDirty {
+		statsLock.Unlock()
+		return
+	}
+	bs, err := json.Marshal(stats)
+	statsDirty = false
+	statsLock.Unlock()
+	if err != nil {
+		log.Println("couldn't marshal leaderboard stats", err.Error())
+		return
+	}
+	if err := os.WriteFile(leaderboardPath, bs, 0644); err != nil {
+		log.Println("couldn't save leaderboard stats", err.Error())
+	}
+}
+
+// leaderboard show <game|all> [day|week|month|all]
+// leaderboard hide
+func HandleLeaderboardMessage(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "show":
+		game, period := "all", "all"
+		if len(args) > 1 {
+			game = args[1]
+		}
+		if len(args) > 2 {
+			period = args[2]
+		}
+		ShowLeaderboard(game, period)
+	case "hide":
+		leaderboardShown = false
+	}
+}
+
+func ShowLeaderboard(game, period string) {
+	days, ok := leaderboardPeriods[period]
+	if !ok {
+		period, days = "all", 0
+	}
+	statsLock.Lock()
+	totals := collectStats(game, days)
+	statsLock.Unlock()
+	leaderboardData = rankStats(game, totals)
+	leaderboardTitle = fmt.Sprintf("%s - %s", strings.ToUpper(game), period)
+	leaderboardTime = 0
+	leaderboardShown = true
+}
+
+// collectStats sums up each players stats over the last n days
+// (or everything when n is 0) for the game, or for all games.
+// Should be called with the stats lock held.
+func collectStats(game string, days int) map[string]*playerStats {
+	totals := map[string]*playerStats{}
+	cutoff := ""
+	if days > 0 {
+		cutoff = time.Now().AddDate(0, 0, 1-days).Format(dayKeyFormat)
+	}
+	for g, byDay := range stats {
+		if game != "all" && g != game {
+			continue
+		}
+		for day, byPlayer := range byDay {
+			if day < cutoff {
+				continue
+			}
+			for player, s := range byPlayer {
+				if _, ok := totals[player]; !ok {
+					totals[player] = &playerStats{Payout: big.NewInt(0)}
+				}
+				totals[player].add(s)
+			}
+		}
+	}
+	return totals
+}
+
+// rankStats orders players by the stat that matters most for the game
+func rankStats(game string, totals map[string]*playerStats) []leaderboardRow {
+	type ranked struct {
+		player string
+		stats  *playerStats
+	}
+	players := []ranked{}
+	for p, s := range totals {
+		players = append(players, ranked{p, s})
+	}
+	var better func(a, b *playerStats) bool
+	var value func(s *playerStats) string
+	switch game {
+	case "plinko", "slots":
+		better = func(a, b *playerStats) bool { return a.Payout.Cmp(b.Payout) > 0 }
+		value = func(s *playerStats) string { return fmt.Sprintf("%s (%d/%d)", s.Payout, s.Wins, s.Plays) }
+	case "tanks":
+		better = func(a, b *playerStats) bool {
+			if a.Wins != b.Wins {
+				return a.Wins > b.Wins
+			}
+			return a.Kills > b.Kills
+		}
+		value = func(s *playerStats) string { return fmt.Sprintf("%dW %dK", s.Wins, s.Kills) }
+	case "cube":
+		better = func(a, b *playerStats) bool { return a.Moves > b.Moves }
+		value = func(s *playerStats) string { return fmt.Sprintf("%d moves", s.Moves) }
+	case "snake":
+		better = func(a, b *playerStats) bool { return a.HighScore > b.HighScore }
+		value = func(s *playerStats) string { return fmt.Sprint(s.HighScore) }
+	default:
+		better = func(a, b *playerStats) bool {
+			if a.Wins != b.Wins {
+				return a.Wins > b.Wins
+			}
+			return a.Plays > b.Plays
+		}
+		value = func(s *playerStats) string { return fmt.Sprintf("%d wins", s.Wins) }
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if better(players[i].stats, players[j].stats) != better(players[j].stats, players[i].stats) {
+			return better(players[i].stats, players[j].stats)
+		}
+		return players[i].player < players[j].player
+	})
+	rows := []leaderboardRow{}
+	for i := 0; i < len(players) && i < leaderboardRows; i++ {
+		rows = append(rows, leaderboardRow{players[i].player, value(players[i].stats)})
+	}
+	return rows
+}
+
+func UpdateLeaderboard(delta float64) {
+	if !leaderboardShown {
+		return
+	}
+	leaderboardTime += delta
+	if leaderboardTime > leaderboardShowTime*1000+leaderboardSlide {
+		leaderboardShown = false
+	}
+}
+
+// leaderboardOffset gets how far off screen the panel is
+// for sliding in and back out again
+func leaderboardOffset() float64 {
+	outAt := leaderboardShowTime * 1000
+	t := 1.0
+	if leaderboardTime < leaderboardSlide {
+		t = leaderboardTime / leaderboardSlide
+	} else if leaderboardTime > outAt {
+		t = 1 - (leaderboardTime-outAt)/leaderboardSlide
+	}
+	t = math.Max(0, math.Min(1, t))
+	// ease out cubic
+	eased := 1 - math.Pow(1-t, 3)
+	return (1 - eased) * (leaderboardWidth + 100)
+}
+
+func DrawLeaderboard() {
+	if !leaderboardShown {
+		return
+	}
+	x := float32(leaderboardX + leaderboardOffset())
+	h := int32(leaderboardRowH*(leaderboardRows+1) + 40)
+	rl.DrawRectangle(int32(x), leaderboardY, leaderboardWidth, h, rl.Color{R: 0, G: 0, B: 0, A: 192})
+	rl.DrawTextEx(leaderboardFont, leaderboardTitle, rl.Vector2{X: x + 20, Y: leaderboardY + 10}, leaderboardTextSize, 0, rl.Gold)
+	if len(leaderboardData) == 0 {
+		rl.DrawTextEx(leaderboardFont, "no results yet", rl.Vector2{X: x + 20, Y: leaderboardY + leaderboardRowH + 20}, leaderboardTextSize, 0, rl.Gray)
+		return
+	}
+	for i, row := range leaderboardData {
+		// each row fades in after the one above it
+		shownFor := leaderboardTime - leaderboardSlide - float64(i)*leaderboardRowDelay
+		if shownFor <= 0 {
+			break
+		}
+		a := uint8(math.Min(1, shownFor/leaderboardSlide) * 255)
+		y := float32(leaderboardY + leaderboardRowH*(i+1) + 20)
+		color := rl.Color{R: 0x00, G: 0xFF, B: 0x00, A: a}
+		if i == 0 {
+			color = rl.Color{R: 0xFF, G: 0xCB, B: 0x00, A: a}
+		}
+		rl.DrawTextEx(leaderboardFont, fmt.Sprintf("%2d. %s", i+1, row.player), rl.Vector2{X: x + 20, Y: y}, leaderboardTextSize, 0, color)
+		w := rl.MeasureTextEx(leaderboardFont, row.value, leaderboardTextSize, 0).X
+		rl.DrawTextEx(leaderboardFont, row.value, rl.Vector2{X: x + leaderboardWidth - 20 - w, Y: y}, leaderboardTextSize, 0, color)
+	}
+}
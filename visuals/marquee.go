@@ -4,16 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"image"
 	"image/color"
-	"image/gif"
 	"log"
 	"math/rand"
-	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
@@ -28,6 +26,7 @@ const (
 	marqueeTextSize   = 120
     xlMarqueeTextSize = 512
 	xlYOffset  = screenHeight / 2
+	emoteSize  = 112 // px wide at the size fetched from the cdn
 	regYOffset = -5
 )
 
@@ -37,10 +36,7 @@ type MarqueeMsg struct {
 }
 
 type imageInfo struct {
-	img          rl.Texture2D
-	animated     bool
-	frameCount   int
-	delay        []int
+	img          *imagecache.Image
 	currentFrame int
 	frameCounter int
 }
@@ -143,10 +139,7 @@ func (m *Marquee) setText(msg MarqueeMsg) {
 		emoteData := strings.Split(msg.Emotes, "/")
 		for _, e := range emoteData {
 			split := strings.Split(e, ":")
-			imgInfo, err := getImageFromCDN(split[0])
-			if err != nil {
-				log.Fatal(err)
-			}
+			imgInfo := getImageFromCDN(split[0])
 			indices := strings.Split(split[1], ",")
 			//eIndices := make([]emoteIndex, len(indices))
 			for _, i := range indices {
@@ -182,7 +175,7 @@ func (m *Marquee) setText(msg MarqueeMsg) {
 			m.totalWidth += int(rl.MeasureTextEx(*m.font, txt, m.textSize, 0).X)
 			offsetPoints = append(offsetPoints, float64(m.totalWidth))
 			m.sequence = append(m.sequence, v.imgInfo)
-			m.totalWidth += int(v.imgInfo.img.Width / int32(v.imgInfo.frameCount))
+			m.totalWidth += v.imgInfo.width()
 			offsetPoints = append(offsetPoints, float64(m.totalWidth))
 		}
 		m.sequence = append(m.sequence, strippedMsg)
@@ -238,17 +231,26 @@ func updateEmoteCache(delta float64) {
 }
 
 func (i *imageInfo) update(delta float64) {
-	if !i.animated {
+	if !i.img.Ready() || i.img.Frames() < 2 {
 		return
 	}
 	i.frameCounter += int(delta)
-	if i.frameCounter >= i.delay[i.currentFrame]*10 {
-		i.currentFrame = (i.currentFrame + 1) % i.frameCount
+	if i.frameCounter >= i.img.Delay()[i.currentFrame]*10 {
+		i.currentFrame = (i.currentFrame + 1) % i.img.Frames()
 		i.frameCounter = 0
 	}
 
 }
 
+// width is how much room the emote takes up, which is a guess
+// until it's loaded
+func (i *imageInfo) width() int {
+	if !i.img.Ready() {
+		return emoteSize
+	}
+	return i.img.FrameWidth()
+}
+
 func DisableMarquees() {
     marqueesEnabled = false
     marquees = []*Marquee{}
@@ -272,16 +274,20 @@ func (m *Marquee) draw() {
 			case *imageInfo:
 				drawX := int32(m.x + m.xOffsets[k])
 				drawY := int32(m.y)
-				if !thing.animated {
-					rl.DrawTexture(thing.img, drawX, drawY, rl.White)
+				tex := thing.img.Texture()
+				if !thing.img.Ready() {
+					src := rl.Rectangle{X: 0, Y: 0, Width: float32(tex.Width), Height: float32(tex.Height)}
+					dest := rl.Rectangle{X: float32(drawX), Y: float32(drawY), Width: emoteSize, Height: emoteSize}
+					rl.DrawTexturePro(tex, src, dest, rl.Vector2{}, 0, rl.Fade(rl.White, 0.3))
 				} else {
+					fw := float32(thing.img.FrameWidth())
 					r := rl.Rectangle{
-						X:      float32(thing.currentFrame) * float32(thing.img.Width) / float32(thing.frameCount),
+						X:      float32(thing.currentFrame) * fw,
 						Y:      0,
-						Width:  float32(thing.img.Width) / float32(thing.frameCount),
-						Height: float32(thing.img.Height),
+						Width:  fw,
+						Height: float32(tex.Height),
 					}
-					rl.DrawTextureRec(thing.img, r, rl.Vector2{X: float32(drawX), Y: float32(drawY)}, rl.White)
+					rl.DrawTextureRec(tex, r, rl.Vector2{X: float32(drawX), Y: float32(drawY)}, rl.White)
 				}
 			}
 		}
@@ -292,73 +298,13 @@ func (m *Marquee) SetSpeed(speed float64) {
 	m.speed = speed
 }
 
-func getImageFromCDN(id string) (*imageInfo, error) {
+func getImageFromCDN(id string) *imageInfo {
 	// check cache first
 	if img, ok := emoteCache[id]; ok {
-		return img, nil
+		return img
 	}
 
 	url := fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%s/default/dark/3.0", id)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	var img image.Image
-	var rimg *rl.Image
-	info := imageInfo{frameCount: 1}
-	imgType := resp.Header.Get("content-type")
-	if imgType == "" {
-		imgType = "image/png"
-	}
-	switch imgType {
-	case "image/gif":
-		gif, err := gif.DecodeAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		pixels := make([]byte, gif.Config.Height*gif.Config.Width*len(gif.Image)*4)
-		for row := 0; row < gif.Config.Height; row++ {
-			for inum := 0; inum < len(gif.Image); inum++ {
-				for x := 0; x < gif.Config.Width; x++ {
-					pixelIndex := (row * len(gif.Image) * gif.Config.Width * 4) + (inum * gif.Config.Width * 4) + (x * 4)
-					pc := gif.Image[inum].At(x, row)
-					r, g, b, a := pc.RGBA()
-					pixels[pixelIndex] = byte(r)
-					pixels[pixelIndex+1] = byte(g)
-					pixels[pixelIndex+2] = byte(b)
-					pixels[pixelIndex+3] = byte(a)
-				}
-
-			}
-		}
-		rimg = rl.NewImage(pixels, int32(gif.Config.Width*len(gif.Image)), int32(gif.Config.Height), 1, rl.UncompressedR8g8b8a8)
-		info.animated = true
-		info.delay = gif.Delay
-		noDelay := true
-		for _, v := range gif.Delay {
-			if v != 0 {
-				noDelay = false
-				break
-			}
-		}
-		if noDelay {
-			for i := 0; i < len(info.delay); i++ {
-				info.delay[i] = 7
-			}
-		}
-		info.frameCount = len(gif.Image)
-	case "image/png":
-		img, _, err = image.Decode(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		rimg = rl.NewImageFromImage(img)
-	}
-
-	info.img = rl.LoadTextureFromImage(rimg)
-
-	emoteCache[id] = &info
-	return emoteCache[id], nil
+	emoteCache[id] = &imageInfo{img: imagecache.Get(url)}
+	return emoteCache[id]
 }
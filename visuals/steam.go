@@ -3,25 +3,25 @@ package visuals
 import (
 	"encoding/json"
 	"fmt"
-	"image"
-	_ "image/jpeg"
 	"math/rand"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/MattSwanson/burtbot_overlay/imagecache"
 	rl "github.com/MattSwanson/raylib-go/raylib"
 )
 
 const (
 	timePlayedThreshold = 10
 	timerStart          = 60 * 60
+	steamIconSize       = 160
 )
 
 var userID string = "76561197968481769"
 var draw bool
 var drawTimer bool
-var appImg rl.Texture2D
+var appImg *imagecache.Image
 var gameName string
 var bgWidth int
 var timeRemaining int = timerStart
@@ -35,7 +35,7 @@ type appEntry struct {
 	TimeLastPlayed  int    `json:"rtime_last_played"`
 	Name            string `json:"name"`
 	ImgIconURL      string `json:"img_icon_url"`
-	IconTex         rl.Texture2D
+	icon            *imagecache.Image
 }
 
 type steamAPIResponse struct {
@@ -53,12 +53,21 @@ func DrawSteamOverlay() {
 		return
 	}
 	rl.DrawRectangleV(rl.Vector2{float32(screenWidth)/3 - 20, float32(screenHeight)/3 - 20}, rl.Vector2{float32(bgWidth), 272}, rl.Color{0, 0, 0, 192})
-	rl.DrawTextureEx(appImg, rl.Vector2{float32(screenWidth) / 3, float32(screenHeight) / 3}, 0, 5.0, rl.White)
+	tex := appImg.Texture()
+	src := rl.Rectangle{X: 0, Y: 0, Width: float32(tex.Width), Height: float32(tex.Height)}
+	dest := rl.Rectangle{X: float32(screenWidth) / 3, Y: float32(screenHeight) / 3, Width: steamIconSize, Height: steamIconSize}
+	rl.DrawTexturePro(tex, src, dest, rl.Vector2{}, 0, rl.White)
 	rl.DrawTextEx(bopFont, gameName, rl.Vector2{float32(screenWidth) / 3, float32(screenHeight)/3 + 170}, 72.0, 0, rl.Blue)
 
 }
 
+// GetRandomGame picks a game off the list in the background
+// so the api and icons don't hold anything up
 func (s *Steam) GetRandomGame() {
+	go s.getRandomGame()
+}
+
+func (s *Steam) getRandomGame() {
 	apiKey := os.Getenv("STEAM_API_KEY")
 	url := fmt.Sprintf("http://api.steampowered.com/IPlayerService/GetOwnedGames/v0001/?key=%s&steamid=%s&format=json&include_appinfo=1", apiKey, userID)
 	req, err := http.NewRequest("GET", url, nil)
@@ -72,6 +81,7 @@ func (s *Steam) GetRandomGame() {
 		fmt.Println("Error accessing Steam API: ", err.Error())
 		return
 	}
+	defer resp.Body.Close()
 	r := steamAPIResponse{}
 	err = json.NewDecoder(resp.Body).Decode(&r)
 	if err != nil {
@@ -91,34 +101,20 @@ func (s *Steam) GetRandomGame() {
 		filtered[i], filtered[j] = filtered[j], filtered[i]
 	})
 	fmt.Println("set is ", len(filtered))
-	filtered = filtered[:20]
+	if len(filtered) > 20 {
+		filtered = filtered[:20]
+	}
+	if len(filtered) == 0 {
+		return
+	}
 
 	// Get the first 20? icons
-	var img []image.Image = make([]image.Image, 20)
-	var rimg []*rl.Image = make([]*rl.Image, 20)
 	for k, app := range filtered {
 		url = fmt.Sprintf("https://media.steampowered.com/steamcommunity/public/images/apps/%d/%s.jpg", app.AppID, app.ImgIconURL)
-		resp, err = http.Get(url)
-		if err != nil {
-			fmt.Println("Couldn't get img for steam api ", err.Error())
-			return
-		}
-		img[k], _, err = image.Decode(resp.Body)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-		recolor := image.NewRGBA(image.Rect(0, 0, img[k].Bounds().Dx(), img[k].Bounds().Dy()))
-		for x := 0; x < img[k].Bounds().Dx(); x++ {
-			for y := 0; y < img[k].Bounds().Dy(); y++ {
-				recolor.Set(x, y, img[k].At(x, y))
-			}
-		}
-		rimg[k] = rl.NewImageFromImage(recolor)
-		filtered[k].IconTex = rl.LoadTextureFromImage(rimg[k])
-		resp.Body.Close()
+		filtered[k].icon = imagecache.Get(url)
 	}
 
-	appImg = filtered[0].IconTex
+	appImg = filtered[0].icon
 	gameName = ""
 	bgWidth = 0
 	draw = true
@@ -127,7 +123,7 @@ func (s *Steam) GetRandomGame() {
 		winner := 0
 		for i := 0; i < 100-randOff; i++ {
 			idx := i % len(filtered)
-			appImg = filtered[idx].IconTex
+			appImg = filtered[idx].icon
 			winner = idx
 			time.Sleep(time.Millisecond * 70)
 		}